@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type changeSide int
+
+const (
+	sideUnknown changeSide = iota
+	sideA
+	sideB
+	sideBoth
+)
+
+type baseline struct {
+	RootA   string                   `json:"rootA"`
+	RootB   string                   `json:"rootB"`
+	Saved   time.Time                `json:"saved"`
+	Entries map[string]manifestEntry `json:"entries"`
+}
+
+func baselinePath(rootA, rootB string) string {
+	dir := dataDir()
+	if dir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(rootA + "\x00" + rootB))
+	return filepath.Join(dir, "baselines", hex.EncodeToString(sum[:8])+".json")
+}
+
+func loadBaseline(rootA, rootB string) *baseline {
+	base := &baseline{RootA: rootA, RootB: rootB, Entries: make(map[string]manifestEntry)}
+
+	path := baselinePath(rootA, rootB)
+	if path == "" {
+		return base
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return base
+	}
+
+	var loaded baseline
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring corrupt baseline %s: %v\n", path, err)
+		return base
+	}
+	if loaded.RootA != rootA || loaded.RootB != rootB || loaded.Entries == nil {
+		return base
+	}
+	return &loaded
+}
+
+func (base *baseline) save() error {
+	path := baselinePath(base.RootA, base.RootB)
+	if path == "" {
+		return fmt.Errorf("cannot determine data directory")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	base.Saved = time.Now()
+	data, err := json.Marshal(base)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (m manifestEntry) matches(e *fileEntry) bool {
+	if m.Size != e.info.Size() || m.Mode != e.info.Mode() {
+		return false
+	}
+	if m.Hash != "" && e.hash != "" && m.Hash != e.hash {
+		return false
+	}
+	return true
+}
+
+func classifyChanges(diffs []diffEntry, base *baseline) {
+	for i, d := range diffs {
+		if d.kind != diffChanged {
+			continue
+		}
+		m, ok := base.Entries[d.relPath]
+		if !ok {
+			continue
+		}
+		sameA := m.matches(d.entryA)
+		sameB := m.matches(d.entryB)
+		switch {
+		case !sameA && sameB:
+			diffs[i].side = sideA
+		case sameA && !sameB:
+			diffs[i].side = sideB
+		case !sameA && !sameB:
+			diffs[i].side = sideBoth
+		}
+	}
+}
+
+func (base *baseline) update(listA []fileEntry, diffs []diffEntry) {
+	entries := make(map[string]manifestEntry, len(listA))
+	pending := make(map[string]bool, len(diffs))
+	for _, d := range diffs {
+		pending[d.relPath] = true
+		switch d.kind {
+		case diffSynced:
+			e := d.entryA
+			if d.side == sideB {
+				e = d.entryB
+			}
+			if e != nil {
+				entries[d.relPath] = toManifestEntry(e)
+			}
+		case diffChanged:
+			if m, ok := base.Entries[d.relPath]; ok {
+				entries[d.relPath] = m
+			}
+		}
+	}
+
+	for i := range listA {
+		if !pending[listA[i].relPath] {
+			entries[listA[i].relPath] = toManifestEntry(&listA[i])
+		}
+	}
+	base.Entries = entries
+}
+
+func sideSymbol(s changeSide) string {
+	switch s {
+	case sideA:
+		return ">"
+	case sideB:
+		return "<"
+	case sideBoth:
+		return "!"
+	default:
+		return "~"
+	}
+}
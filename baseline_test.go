@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyChanges(t *testing.T) {
+	base := &baseline{Entries: map[string]manifestEntry{
+		"a.txt": {Path: "a.txt", Size: 10, Mode: 0644},
+		"b.txt": {Path: "b.txt", Size: 10, Mode: 0644},
+		"c.txt": {Path: "c.txt", Size: 10, Mode: 0644},
+		"h.txt": {Path: "h.txt", Size: 10, Mode: 0644, Hash: "old"},
+	}}
+	entry := func(size int64, hash string) *fileEntry {
+		return &fileEntry{info: fakeInfo{size: size, mode: 0644}, hash: hash}
+	}
+
+	diffs := []diffEntry{
+		{kind: diffChanged, relPath: "a.txt", entryA: entry(12, ""), entryB: entry(10, "")},
+		{kind: diffChanged, relPath: "b.txt", entryA: entry(10, ""), entryB: entry(12, "")},
+		{kind: diffChanged, relPath: "c.txt", entryA: entry(11, ""), entryB: entry(12, "")},
+		{kind: diffChanged, relPath: "h.txt", entryA: entry(10, "old"), entryB: entry(10, "new")},
+		{kind: diffChanged, relPath: "new.txt", entryA: entry(1, ""), entryB: entry(2, "")},
+	}
+	classifyChanges(diffs, base)
+
+	want := []changeSide{sideA, sideB, sideBoth, sideB, sideUnknown}
+	for i, w := range want {
+		if diffs[i].side != w {
+			t.Errorf("%s: side = %d, want %d", diffs[i].relPath, diffs[i].side, w)
+		}
+	}
+}
+
+func TestRunSync_DeleteUpdatesBaseline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dirA, dirB := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(dirA, "kept.txt"), "same")
+	writeTestFile(t, filepath.Join(dirB, "kept.txt"), "same")
+	writeTestFile(t, filepath.Join(dirB, "extra.txt"), "only in B")
+
+	if code := runSync(defaultConfig(), []string{dirA, "--against", dirB, "--full", "--delete"}); code != exitOK {
+		t.Fatalf("runSync = %d, want %d", code, exitOK)
+	}
+	if _, err := os.Lstat(filepath.Join(dirB, "extra.txt")); !os.IsNotExist(err) {
+		t.Errorf("extra.txt still in B: %v", err)
+	}
+	base := loadBaseline(dirA, dirB)
+	if _, ok := base.Entries["kept.txt"]; !ok {
+		t.Error("kept.txt missing from the saved baseline")
+	}
+	if _, ok := base.Entries["extra.txt"]; ok {
+		t.Error("deleted extra.txt still in the saved baseline")
+	}
+}
+
+func TestBaselineUpdate(t *testing.T) {
+	base := &baseline{Entries: map[string]manifestEntry{
+		"pending.txt": {Path: "pending.txt", Size: 5},
+		"gone.txt":    {Path: "gone.txt", Size: 1},
+	}}
+	listA := []fileEntry{
+		{relPath: "same.txt", info: fakeInfo{size: 3}},
+		{relPath: "pending.txt", info: fakeInfo{size: 7}},
+		{relPath: "synced.txt", info: fakeInfo{size: 9}},
+		{relPath: "onlya.txt", info: fakeInfo{size: 2}},
+	}
+	diffs := []diffEntry{
+		{kind: diffChanged, relPath: "pending.txt"},
+		{kind: diffSynced, relPath: "synced.txt", entryA: &listA[2]},
+		{kind: diffOnlyA, relPath: "onlya.txt"},
+		{kind: diffSynced, relPath: "deleted.txt"},
+	}
+	base.update(listA, diffs)
+
+	if m, ok := base.Entries["same.txt"]; !ok || m.Size != 3 {
+		t.Errorf("same.txt = %+v, %v; want recorded with size 3", m, ok)
+	}
+	if m := base.Entries["pending.txt"]; m.Size != 5 {
+		t.Errorf("pending.txt size = %d, want previous baseline size 5", m.Size)
+	}
+	if m := base.Entries["synced.txt"]; m.Size != 9 {
+		t.Errorf("synced.txt size = %d, want 9", m.Size)
+	}
+	for _, p := range []string{"onlya.txt", "gone.txt", "deleted.txt"} {
+		if _, ok := base.Entries[p]; ok {
+			t.Errorf("%s should not be in the baseline", p)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	hashCacheVersion   = 1
+	defaultPruneMaxAge = 30 * 24 * time.Hour
+)
+
+type cacheRecord struct {
+	Hash string `json:"hash"`
+	Path string `json:"path"`
+	Seen int64  `json:"seen"`
+}
+
+type cacheFile struct {
+	Version  int                    `json:"version"`
+	Checksum string                 `json:"checksum"`
+	Entries  map[string]cacheRecord `json:"entries"`
+}
+
+type hashCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]cacheRecord
+	hits    int
+	misses  int
+	dirty   bool
+}
+
+func hashCachePath() string {
+	dir := dataDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "hashcache.json")
+}
+
+func cacheKey(info os.FileInfo) (string, bool) {
+	dev, ino, ok := fileIdentity(info)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d:%d:%d", dev, ino, info.Size(), info.ModTime().UnixNano()), true
+}
+
+func entriesChecksum(entries map[string]cacheRecord) string {
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		r := entries[k]
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d\n", k, r.Hash, r.Path, r.Seen)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func loadHashCache(path string) *hashCache {
+	c := &hashCache{path: path, entries: make(map[string]cacheRecord)}
+	if path == "" {
+		return c
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cannot read hash cache %s: %v\n", path, err)
+		return c
+	}
+
+	var f cacheFile
+	err = json.Unmarshal(data, &f)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("cannot parse: %w", err)
+	case f.Version != hashCacheVersion:
+		err = fmt.Errorf("unsupported version %d", f.Version)
+	case f.Checksum != entriesChecksum(f.Entries):
+		err = fmt.Errorf("checksum mismatch")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: discarding corrupt hash cache %s: %v\n", path, err)
+		c.dirty = true
+		return c
+	}
+
+	if f.Entries != nil {
+		c.entries = f.Entries
+	}
+	return c
+}
+
+func (c *hashCache) lookup(info os.FileInfo) (string, bool) {
+	key, ok := cacheKey(info)
+	if !ok {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return "", false
+	}
+	c.hits++
+	r.Seen = time.Now().Unix()
+	c.entries[key] = r
+	c.dirty = true
+	return r.Hash, true
+}
+
+func (c *hashCache) store(info os.FileInfo, path, hash string) {
+	key, ok := cacheKey(info)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheRecord{Hash: hash, Path: path, Seen: time.Now().Unix()}
+	c.dirty = true
+}
+
+func (c *hashCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty || c.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(cacheFile{
+		Version:  hashCacheVersion,
+		Checksum: entriesChecksum(c.entries),
+		Entries:  c.entries,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+func (c *hashCache) prune(maxAge time.Duration) (removed int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := time.Now().Add(-maxAge).Unix()
+	for key, r := range c.entries {
+		stale := r.Seen < cutoff
+		if !stale {
+			info, err := os.Stat(r.Path)
+			if err != nil {
+				stale = true
+			} else if current, ok := cacheKey(info); !ok || current != key {
+				stale = true
+			}
+		}
+		if stale {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	if removed > 0 {
+		c.dirty = true
+	}
+	return removed
+}
+
+func hashWithCache(path string, info os.FileInfo, c *hashCache) (string, error) {
+	if c == nil {
+		return hashFile(path)
+	}
+	if h, ok := c.lookup(info); ok {
+		return h, nil
+	}
+
+	h, err := hashFile(path)
+	if err != nil {
+		return h, err
+	}
+	if after, err := os.Stat(path); err == nil {
+		if keyBefore, ok := cacheKey(info); ok {
+			if keyAfter, ok := cacheKey(after); ok && keyAfter == keyBefore {
+				c.store(info, path, h)
+			}
+		}
+	}
+	return h, nil
+}
+
+func runCache(cfg config, args []string) int {
+	var maxAge time.Duration
+	fs := newFlagSet("cache")
+	fs.DurationVar(&maxAge, "older-than", defaultPruneMaxAge, "with prune, also drop entries not used within this `duration`")
+	positional, err := parseCommandLine(fs, args)
+	if err != nil {
+		return reportUsageError("cache", err)
+	}
+	if len(positional) != 1 {
+		return reportUsageError("cache", fmt.Errorf("expected one of: stats, prune, clear"))
+	}
+
+	path := hashCachePath()
+	switch positional[0] {
+	case "stats":
+		c := loadHashCache(path)
+		var size int64
+		if info, err := os.Stat(path); err == nil {
+			size = info.Size()
+		}
+		var oldest, newest int64
+		for _, r := range c.entries {
+			if oldest == 0 || r.Seen < oldest {
+				oldest = r.Seen
+			}
+			if r.Seen > newest {
+				newest = r.Seen
+			}
+		}
+		fmt.Printf("Cache:   %s\n", path)
+		fmt.Printf("Entries: %d\n", len(c.entries))
+		fmt.Printf("Size:    %d bytes\n", size)
+		if len(c.entries) > 0 {
+			fmt.Printf("Used:    %s … %s\n",
+				time.Unix(oldest, 0).Format("2006-01-02 15:04"),
+				time.Unix(newest, 0).Format("2006-01-02 15:04"))
+		}
+	case "prune":
+		c := loadHashCache(path)
+		removed := c.prune(maxAge)
+		if err := c.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitDiff
+		}
+		fmt.Printf("Pruned %d entries, %d remaining\n", removed, len(c.entries))
+	case "clear":
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitDiff
+		}
+		fmt.Println("Hash cache cleared")
+	default:
+		return reportUsageError("cache", fmt.Errorf("unknown cache action %q", positional[0]))
+	}
+	return exitOK
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func fileIdentity(info os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashCache_ReusesAndInvalidates(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache.json")
+	file := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(file)
+	if _, _, ok := fileIdentity(info); !ok {
+		t.Skip("no inode identity on this platform")
+	}
+
+	c := loadHashCache(cachePath)
+	h1, err := hashWithCache(file, info, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = loadHashCache(cachePath)
+	if got, ok := c.lookup(info); !ok || got != h1 {
+		t.Fatalf("lookup after reload = %q, %v; want %q, true", got, ok, h1)
+	}
+
+	later := info.ModTime().Add(time.Second)
+	if err := os.WriteFile(file, []byte("world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	info2, _ := os.Stat(file)
+	if _, ok := c.lookup(info2); ok {
+		t.Fatal("lookup hit for a modified file")
+	}
+	h2, _ := hashWithCache(file, info2, c)
+	if h2 == h1 {
+		t.Error("modified file reused the old hash")
+	}
+}
+
+func TestHashCache_DiscardsCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache.json")
+
+	for _, data := range []string{
+		"{not json",
+		`{"version": 1, "checksum": "bogus", "entries": {"1:2:3:4": {"hash": "x", "path": "/p", "seen": 1}}}`,
+		`{"version": 99, "entries": {}}`,
+	} {
+		if err := os.WriteFile(cachePath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c := loadHashCache(cachePath)
+		if len(c.entries) != 0 {
+			t.Errorf("loadHashCache(%q) kept %d entries, want 0", data, len(c.entries))
+		}
+		if err := c.save(); err != nil {
+			t.Fatal(err)
+		}
+		if reloaded := loadHashCache(cachePath); len(reloaded.entries) != 0 {
+			t.Errorf("rewritten cache has %d entries, want 0", len(reloaded.entries))
+		}
+	}
+}
+
+func TestHashCache_Prune(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(file)
+	key, ok := cacheKey(info)
+	if !ok {
+		t.Skip("no inode identity on this platform")
+	}
+
+	now := time.Now().Unix()
+	c := &hashCache{entries: map[string]cacheRecord{
+		key:       {Hash: "live", Path: file, Seen: now},
+		"1:1:1:1": {Hash: "old", Path: file, Seen: now - 100*24*3600},
+		"2:2:2:2": {Hash: "gone", Path: filepath.Join(dir, "missing"), Seen: now},
+		"3:3:3:3": {Hash: "replaced", Path: file, Seen: now},
+	}}
+
+	if removed := c.prune(defaultPruneMaxAge); removed != 3 {
+		t.Errorf("prune removed %d entries, want 3", removed)
+	}
+	if _, ok := c.entries[key]; !ok || len(c.entries) != 1 {
+		t.Errorf("prune left %v, want only the live entry", c.entries)
+	}
+}
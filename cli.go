@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+var errFlagParse = errors.New("invalid flags")
+
+type command struct {
+	name     string
+	synopsis string
+	summary  string
+	run      func(cfg config, args []string) int
+}
+
+func commands() []command {
+	return []command{
+		{"diff", "[flags] [path] [number]", "Compare a tree with its mirror without changing either side (default command).", runDiff},
+		{"sync", "[flags] [path] [number]", "Copy non-text .docx changes and file modes from A to B (everything with --full).", runSync},
+		{"plan", "[flags] [path] [number]", "Print the full list of actions that would make B mirror A.", runPlan},
+		{"apply", "[flags] <plan.json>", "Apply a plan written by 'differ plan --json'.", runApply},
+		{"snapshot", "[flags] [path]", "Record every entry of a tree in a manifest that can stand in for either side of a diff.", runSnapshot},
+		{"undo", "[flags] [run-id]", "Restore the files and modes changed by a sync run (default: the latest).", runUndo},
+		{"status", "", "Show drift for every mirrored directory in $HOME.", runStatus},
+		{"mirrors", "[path] [number]", "Show which mirror rule resolves the mirror of a path.", runMirrors},
+		{"docx", "<a.docx> <b.docx>", "Compare the parts of two .docx files.", runDocx},
+		{"cache", "[flags] stats|prune|clear", "Inspect or maintain the on-disk hash cache used by --hashes.", runCache},
+		{"config", "[flags]", "Show the configuration file location and effective settings.", runConfig},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands() {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func run(cfg config, args []string) int {
+	if len(args) == 0 {
+		return runDiff(cfg, args)
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if c, ok := findCommand(args[1]); ok {
+				return c.run(cfg, []string{"--help"})
+			}
+			fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", args[1])
+			printUsage(os.Stderr)
+			return exitUsageErr
+		}
+		printUsage(os.Stdout)
+		return exitOK
+	}
+
+	if c, ok := findCommand(args[0]); ok {
+		return c.run(cfg, args[1:])
+	}
+	return runDiff(cfg, args)
+}
+
+func printUsage(w *os.File) {
+	fmt.Fprintln(w, "Usage: differ [command] [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-8s  %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'differ <command> --help' for the flags of a command.")
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	c, _ := findCommand(name)
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: differ %s %s\n\n%s\n", c.name, c.synopsis, c.summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(out, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+func parseCommandLine(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errFlagParse
+		}
+
+		rest := fs.Args()
+		consumed := len(args) - len(rest)
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func reportUsageError(name string, err error) int {
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errFlagParse):
+		return exitUsageErr
+	}
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	fmt.Fprintf(os.Stderr, "Run 'differ %s --help' for usage.\n", name)
+	return exitUsageErr
+}
+
+func runDocx(cfg config, args []string) int {
+	fs := newFlagSet("docx")
+	positional, err := parseCommandLine(fs, args)
+	if err != nil {
+		return reportUsageError("docx", err)
+	}
+	if len(positional) != 2 {
+		return reportUsageError("docx", fmt.Errorf("expected two .docx files"))
+	}
+	for _, p := range positional {
+		if _, err := os.Stat(p); err != nil {
+			return reportUsageError("docx", fmt.Errorf("cannot read %s: %w", p, err))
+		}
+	}
+
+	result := analyzeDocx(positional[0], positional[1])
+	fmt.Println(result.label)
+	for _, dd := range result.details {
+		fmt.Println(colorYellow(fmt.Sprintf("  %-8s  %s  (%s)", categoryLabel(dd.category), dd.name, dd.reason)))
+		printTextDiff(os.Stdout, dd.textDiff)
+	}
+
+	if result.label == "docx:identical" && len(result.details) == 0 {
+		return exitOK
+	}
+	return exitDiff
+}
+
+func runConfig(cfg config, args []string) int {
+	var pathOnly bool
+	fs := newFlagSet("config")
+	fs.BoolVar(&pathOnly, "path", false, "print only the configuration file path")
+	positional, err := parseCommandLine(fs, args)
+	if err != nil {
+		return reportUsageError("config", err)
+	}
+	if len(positional) > 0 {
+		return reportUsageError("config", fmt.Errorf("unexpected argument %q", positional[0]))
+	}
+
+	path := configPath()
+	if pathOnly {
+		fmt.Println(path)
+		return exitOK
+	}
+
+	state := "not found, using defaults"
+	if _, err := os.Stat(path); err == nil {
+		state = "loaded"
+	}
+	fmt.Printf("# %s (%s)\n", path, state)
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitUsageErr
+	}
+	fmt.Println(string(data))
+	return exitOK
+}
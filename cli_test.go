@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantHashes bool
+		wantName   string
+		wantPos    []string
+		wantErr    error
+	}{
+		{"no args", nil, false, "", nil, nil},
+		{"flag before positional", []string{"--hashes", "dir"}, true, "", []string{"dir"}, nil},
+		{"flag after positional", []string{"dir", "3", "--hashes"}, true, "", []string{"dir", "3"}, nil},
+		{"equals form", []string{"--name=x", "dir"}, false, "x", []string{"dir"}, nil},
+		{"separate value", []string{"dir", "--name", "y"}, false, "y", []string{"dir"}, nil},
+		{"double dash ends flags", []string{"--", "--hashes"}, false, "", []string{"--hashes"}, nil},
+		{"unknown flag", []string{"--bogus"}, false, "", nil, errFlagParse},
+		{"help", []string{"--help"}, false, "", nil, flag.ErrHelp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hashes bool
+			var name string
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			fs.BoolVar(&hashes, "hashes", false, "")
+			fs.StringVar(&name, "name", "", "")
+
+			got, err := parseCommandLine(fs, tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseCommandLine(%v) error = %v, want %v", tt.args, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if hashes != tt.wantHashes || name != tt.wantName {
+				t.Errorf("flags = (%v, %q), want (%v, %q)", hashes, name, tt.wantHashes, tt.wantName)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.wantPos, " ") {
+				t.Errorf("positional = %v, want %v", got, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestReportUsageError(t *testing.T) {
+	if got := reportUsageError("diff", flag.ErrHelp); got != exitOK {
+		t.Errorf("reportUsageError(ErrHelp) = %d, want %d", got, exitOK)
+	}
+	if got := reportUsageError("diff", errFlagParse); got != exitUsageErr {
+		t.Errorf("reportUsageError(errFlagParse) = %d, want %d", got, exitUsageErr)
+	}
+}
+
+func TestAddFilterFlags(t *testing.T) {
+	var rules filterRules
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	addFilterFlags(fs, &rules)
+
+	args := []string{"dir", "--exclude", "*.pdf", "--include=keep.pdf", "--no-gitignore", "--exclude", "/out/"}
+	if _, err := parseCommandLine(fs, args); err != nil {
+		t.Fatal(err)
+	}
+	want := []ignorePattern{
+		{pattern: "*.pdf"},
+		{pattern: "keep.pdf", negated: true},
+		{pattern: "out", dirOnly: true, anchored: true},
+	}
+	if len(rules.cli) != len(want) {
+		t.Fatalf("patterns = %+v, want %+v", rules.cli, want)
+	}
+	for i := range want {
+		if rules.cli[i] != want[i] {
+			t.Errorf("pattern %d = %+v, want %+v", i, rules.cli[i], want[i])
+		}
+	}
+	if !rules.noGitignore {
+		t.Error("--no-gitignore not set")
+	}
+
+	if _, err := parseCommandLine(fs, []string{"--exclude", "# nothing"}); err == nil {
+		t.Error("comment accepted as a pattern")
+	}
+}
+
+func TestParseDiffArgs_Against(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	// With work.2 present, an ignored --against would fall back to it.
+	dirA, dirB := filepath.Join(home, "work"), t.TempDir()
+	for _, dir := range []string{dirA, dirA + ".2"} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantPathB string
+		wantErr   bool
+	}{
+		{"one positional", []string{dirA, "--against", dirB}, dirB, false},
+		{"flag before the path", []string{"--against=" + dirB, dirA}, dirB, false},
+		{"two positionals", []string{dirA, "3", "--against", dirB}, "", true},
+		{"empty value", []string{dirA, "--against="}, "", true},
+		{"empty separate value", []string{dirA, "--against", ""}, "", true},
+		{"with --all", []string{dirA, "--against", dirB, "--all"}, "", true},
+		{"missing path", []string{dirA, "--against", filepath.Join(dirB, "nope")}, "", true},
+		{"against itself", []string{dirA, "--against", dirA}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDiffArgs(defaultConfig(), "diff", tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDiffArgs(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if err == nil && (got.pathA != dirA || got.pathB != tt.wantPathB) {
+				t.Errorf("parseDiffArgs(%v) = %s vs %s, want %s vs %s", tt.args, got.pathA, got.pathB, dirA, tt.wantPathB)
+			}
+		})
+	}
+}
+
+func TestParseDiffArgs_IgnoreRules(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	snap := filepath.Join(t.TempDir(), "snap.json")
+	f, err := os.Create(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newManifest(dirB, nil, false).writeJSON(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"with --against", []string{dirA, "--against", dirB, "--ignore-rules", "union"}, false},
+		{"with --all", []string{dirA, "--all", "--ignore-rules", "b"}, true},
+		{"with a manifest", []string{dirA, "--against", snap, "--ignore-rules", "b"}, true},
+		{"config default with a manifest", []string{dirA, "--against", snap}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDiffArgs(defaultConfig(), "diff", tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDiffArgs(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
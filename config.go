@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -8,21 +9,33 @@ import (
 )
 
 type config struct {
-	AlwaysExclude []string `json:"alwaysExclude"`
+	AlwaysExclude []string     `json:"alwaysExclude"`
+	Mirrors       []mirrorRule `json:"mirrors"`
+	IgnorePolicy  string       `json:"ignorePolicy"`
 }
 
 func defaultConfig() config {
 	return config{
 		AlwaysExclude: []string{".git"},
+		Mirrors:       []mirrorRule{{Template: defaultMirrorTemplate}},
+		IgnorePolicy:  ignorePolicyA,
 	}
 }
 
-func configPath() string {
+func dataDir() string {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return ""
 	}
-	return filepath.Join(home, ".local", "share", "trueblocks", "differ", "config.json")
+	return filepath.Join(home, ".local", "share", "trueblocks", "differ")
+}
+
+func configPath() string {
+	dir := dataDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "config.json")
 }
 
 func loadConfig() config {
@@ -41,6 +54,16 @@ func loadConfig() config {
 	if len(fileCfg.AlwaysExclude) > 0 {
 		cfg.AlwaysExclude = fileCfg.AlwaysExclude
 	}
+	if len(fileCfg.Mirrors) > 0 {
+		cfg.Mirrors = fileCfg.Mirrors
+	}
+	if fileCfg.IgnorePolicy != "" {
+		if validIgnorePolicy(fileCfg.IgnorePolicy) {
+			cfg.IgnorePolicy = fileCfg.IgnorePolicy
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: %s: unknown ignorePolicy %q, using %q\n", path, fileCfg.IgnorePolicy, cfg.IgnorePolicy)
+		}
+	}
 
 	return cfg
 }
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 )
 
+const contentChunkSize = 64 * 1024
+
 type diffKind int
 
 const (
@@ -12,15 +17,19 @@ const (
 	diffOnlyB
 	diffChanged
 	diffSynced
+	diffRenamed
+	diffDangling
 )
 
 type diffEntry struct {
-	kind        diffKind
-	relPath     string
+	kind    diffKind
+	relPath string
+	// For diffRenamed, entryA holds the new path and entryB the old one.
 	entryA      *fileEntry
 	entryB      *fileEntry
 	details     []string
 	docxDetails []docxFileDiff
+	side        changeSide
 }
 
 func computeDiff(listA, listB []fileEntry, rootA, rootB string, opts options) []diffEntry {
@@ -40,6 +49,16 @@ func computeDiff(listA, listB []fileEntry, rootA, rootB string, opts options) []
 	for _, a := range listA {
 		seen[a.relPath] = true
 		b, inB := mapB[a.relPath]
+		if a.dangling || (inB && b.dangling) {
+			// The same broken link on both sides is not a difference.
+			if inB && a.dangling && b.dangling {
+				if changes, _ := compareEntries(mapA[a.relPath], b, rootA, rootB, opts); len(changes) == 0 {
+					continue
+				}
+			}
+			diffs = append(diffs, danglingEntry(mapA[a.relPath], b, rootA, rootB, opts))
+			continue
+		}
 		if !inB {
 			diffs = append(diffs, diffEntry{
 				kind:    diffOnlyA,
@@ -63,6 +82,10 @@ func computeDiff(listA, listB []fileEntry, rootA, rootB string, opts options) []
 	}
 
 	for _, b := range listB {
+		if !seen[b.relPath] && b.dangling {
+			diffs = append(diffs, danglingEntry(nil, mapB[b.relPath], rootA, rootB, opts))
+			continue
+		}
 		if !seen[b.relPath] {
 			diffs = append(diffs, diffEntry{
 				kind:    diffOnlyB,
@@ -72,7 +95,100 @@ func computeDiff(listA, listB []fileEntry, rootA, rootB string, opts options) []
 		}
 	}
 
-	return diffs
+	if opts.noRenames {
+		return diffs
+	}
+	return detectRenames(diffs, rootA, rootB, opts)
+}
+
+// detectRenames pairs only-A and only-B regular files with the same content.
+func detectRenames(diffs []diffEntry, rootA, rootB string, opts options) []diffEntry {
+	candidates := make(map[string][]int)
+	for i, d := range diffs {
+		if d.kind == diffOnlyB {
+			if key := renameKey(d.entryB, opts); key != "" {
+				candidates[key] = append(candidates[key], i)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return diffs
+	}
+
+	paired := make(map[int]bool)
+	for i, d := range diffs {
+		if d.kind != diffOnlyA {
+			continue
+		}
+		key := renameKey(d.entryA, opts)
+		for _, j := range candidates[key] {
+			if paired[j] {
+				continue
+			}
+			changes, _ := compareEntries(d.entryA, diffs[j].entryB, rootA, rootB, opts)
+			if !modeOnly(changes) {
+				continue
+			}
+			// A manifest has no contents to read, so size and name must do.
+			if !opts.useHashes && !opts.manifest {
+				if same, _, err := sameContent(d.entryA.diskPath(rootA), diffs[j].entryB.diskPath(rootB)); err != nil || !same {
+					continue
+				}
+			}
+			paired[j] = true
+			diffs[i].kind = diffRenamed
+			diffs[i].entryB = diffs[j].entryB
+			diffs[i].details = changes
+			break
+		}
+	}
+
+	if len(paired) == 0 {
+		return diffs
+	}
+	kept := diffs[:0]
+	for i, d := range diffs {
+		if !paired[i] {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// danglingEntry takes a nil entry for a side the path is missing from.
+func danglingEntry(a, b *fileEntry, rootA, rootB string, opts options) diffEntry {
+	d := diffEntry{kind: diffDangling, entryA: a, entryB: b}
+	switch {
+	case a == nil:
+		d.relPath = b.relPath
+		d.details = []string{"dangling in B"}
+	case b == nil:
+		d.relPath = a.relPath
+		d.details = []string{"dangling in A"}
+	default:
+		d.relPath = a.relPath
+		switch {
+		case a.dangling && b.dangling:
+			d.details = []string{"dangling in both"}
+		case a.dangling:
+			d.details = []string{"dangling in A"}
+		default:
+			d.details = []string{"dangling in B"}
+		}
+		changes, _ := compareEntries(a, b, rootA, rootB, opts)
+		d.details = append(d.details, changes...)
+	}
+	return d
+}
+
+func renameKey(e *fileEntry, opts options) string {
+	if !e.info.Mode().IsRegular() || e.info.Size() == 0 {
+		return ""
+	}
+	if opts.useHashes {
+		return e.hash
+	}
+	return fmt.Sprintf("%d/%s", e.info.Size(), filepath.Base(e.relPath))
 }
 
 func truncHash(h string) string {
@@ -86,12 +202,25 @@ func compareEntries(a, b *fileEntry, rootA, rootB string, opts options) ([]strin
 	var changes []string
 	var docxDets []docxFileDiff
 
+	if typeA, typeB := fileType(a.info.Mode()), fileType(b.info.Mode()); typeA != typeB {
+		return []string{fmt.Sprintf("type: %s vs %s", typeA, typeB)}, nil
+	}
+
 	if a.info.Mode() != b.info.Mode() {
 		changes = append(changes, fmt.Sprintf("mode: %s vs %s", a.info.Mode(), b.info.Mode()))
 	}
 
+	isLinkA := a.info.Mode()&os.ModeSymlink != 0
+	isLinkB := b.info.Mode()&os.ModeSymlink != 0
+	if isLinkA && isLinkB {
+		if a.target != b.target {
+			changes = append(changes, fmt.Sprintf("target: %s vs %s", a.target, b.target))
+		}
+		return changes, nil
+	}
+
 	sizeDiffers := false
-	if !a.info.IsDir() && !b.info.IsDir() {
+	if !a.info.IsDir() && !b.info.IsDir() && !isSpecial(a.info.Mode()) {
 		if opts.useHashes {
 			if a.hash != b.hash {
 				changes = append(changes, fmt.Sprintf("hash: %s vs %s", truncHash(a.hash), truncHash(b.hash)))
@@ -104,18 +233,26 @@ func compareEntries(a, b *fileEntry, rootA, rootB string, opts options) ([]strin
 			if a.info.Size() != b.info.Size() {
 				sizeDiffers = true
 				changes = append(changes, fmt.Sprintf("size: %d vs %d", a.info.Size(), b.info.Size()))
+			} else if opts.content && a.info.Mode().IsRegular() && b.info.Mode().IsRegular() {
+				if detail := compareContent(a, b, rootA, rootB, opts); detail != "" {
+					changes = append(changes, detail)
+				}
 			}
 		}
 	}
 
-	if sizeDiffers && isDocx(a.relPath) {
-		fullA := filepath.Join(rootA, a.relPath)
-		fullB := filepath.Join(rootB, b.relPath)
-		result := analyzeDocx(fullA, fullB)
+	if sizeDiffers && !opts.skipDocx && isDocx(a.relPath) {
+		result := analyzeDocx(a.diskPath(rootA), b.diskPath(rootB))
 		changes = append(changes, result.label)
 		docxDets = result.details
 	}
 
+	if opts.nameForms {
+		if detail := nameFormDetail(a, b); detail != "" {
+			changes = append(changes, detail)
+		}
+	}
+
 	if opts.useDate && !a.info.ModTime().Equal(b.info.ModTime()) {
 		changes = append(changes, fmt.Sprintf("modified: %s vs %s",
 			a.info.ModTime().Format("2006-01-02 15:04:05"),
@@ -124,3 +261,72 @@ func compareEntries(a, b *fileEntry, rootA, rootB string, opts options) ([]strin
 
 	return changes, docxDets
 }
+
+func compareContent(a, b *fileEntry, rootA, rootB string, opts options) string {
+	if !opts.noQuick && a.info.ModTime().Equal(b.info.ModTime()) {
+		return ""
+	}
+
+	same, offset, err := sameContent(a.diskPath(rootA), b.diskPath(rootB))
+	if err != nil {
+		return fmt.Sprintf("content: error (%v)", err)
+	}
+	if !same {
+		return fmt.Sprintf("content: differs at byte %d", offset)
+	}
+	return ""
+}
+
+func sameContent(pathA, pathB string) (bool, int64, error) {
+	fa, err := os.Open(pathA)
+	if err != nil {
+		return false, 0, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(pathB)
+	if err != nil {
+		return false, 0, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, contentChunkSize)
+	bufB := make([]byte, contentChunkSize)
+	var offset int64
+	for {
+		nA, errA := io.ReadFull(fa, bufA)
+		nB, errB := io.ReadFull(fb, bufB)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return false, offset, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, offset, errB
+		}
+
+		n := nA
+		if nB < n {
+			n = nB
+		}
+		if i := firstMismatch(bufA[:n], bufB[:n]); i >= 0 {
+			return false, offset + int64(i), nil
+		}
+		if nA != nB {
+			return false, offset + int64(n), nil
+		}
+		offset += int64(n)
+		if nA < contentChunkSize {
+			return true, offset, nil
+		}
+	}
+}
+
+func firstMismatch(a, b []byte) int {
+	if bytes.Equal(a, b) {
+		return -1
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return len(a)
+}
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestTruncHash(t *testing.T) {
@@ -84,3 +89,183 @@ func TestComputeDiff_Identical(t *testing.T) {
 		t.Errorf("got %d diffs, want 0", len(diffs))
 	}
 }
+
+func TestSameContent(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	big := bytes.Repeat([]byte("x"), 3*contentChunkSize)
+	bigChanged := append([]byte(nil), big...)
+	bigChanged[2*contentChunkSize+5] = 'y'
+
+	tests := []struct {
+		name       string
+		a, b       []byte
+		wantSame   bool
+		wantOffset int64
+	}{
+		{"identical small", []byte("hello"), []byte("hello"), true, 5},
+		{"differ small", []byte("hello"), []byte("help!"), false, 3},
+		{"identical chunk multiple", big, big, true, int64(len(big))},
+		{"differ in later chunk", big, bigChanged, false, 2*contentChunkSize + 5},
+		{"prefix", []byte("abc"), []byte("abcd"), false, 3},
+		{"empty", nil, nil, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same, offset, err := sameContent(write("a", tt.a), write("b", tt.b))
+			if err != nil {
+				t.Fatalf("sameContent returned error: %v", err)
+			}
+			if same != tt.wantSame || offset != tt.wantOffset {
+				t.Errorf("sameContent = (%v, %d), want (%v, %d)", same, offset, tt.wantSame, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestCompareEntries_Content(t *testing.T) {
+	rootA := t.TempDir()
+	rootB := t.TempDir()
+	if err := os.WriteFile(filepath.Join(rootA, "f.txt"), []byte("aaaa"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootB, "f.txt"), []byte("aaab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	same := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := &fileEntry{relPath: "f.txt", info: fakeInfo{name: "f.txt", size: 4, mod: same}}
+	b := &fileEntry{relPath: "f.txt", info: fakeInfo{name: "f.txt", size: 4, mod: same}}
+
+	if changes, _ := compareEntries(a, b, rootA, rootB, options{content: true}); len(changes) != 0 {
+		t.Errorf("quick check should skip files with matching size and mtime, got %v", changes)
+	}
+
+	changes, _ := compareEntries(a, b, rootA, rootB, options{content: true, noQuick: true})
+	if len(changes) != 1 || changes[0] != "content: differs at byte 3" {
+		t.Errorf("compareEntries without quick check = %v, want content difference at byte 3", changes)
+	}
+
+	b.info = fakeInfo{name: "f.txt", size: 4, mod: same.Add(time.Second)}
+	if changes, _ := compareEntries(a, b, rootA, rootB, options{content: true}); len(changes) != 1 {
+		t.Errorf("compareEntries with differing mtime = %v, want one content difference", changes)
+	}
+}
+
+func TestDetectRenames(t *testing.T) {
+	file := func(path string, size int64, hash string) fileEntry {
+		return fileEntry{relPath: path, info: fakeInfo{name: filepath.Base(path), size: size, mode: 0644}, hash: hash}
+	}
+
+	t.Run("by size and name", func(t *testing.T) {
+		rootA, rootB := t.TempDir(), t.TempDir()
+		contents := map[string]string{
+			filepath.Join(rootA, "new", "report.pdf"): strings.Repeat("r", 100),
+			filepath.Join(rootB, "old", "report.pdf"): strings.Repeat("r", 100),
+			filepath.Join(rootA, "new", "notes.txt"):  "version 2",
+			filepath.Join(rootB, "old", "notes.txt"):  "version 1",
+		}
+		for path, content := range contents {
+			writeTestFile(t, path, content)
+		}
+		listA := []fileEntry{file("new/report.pdf", 100, ""), file("new/other.txt", 7, ""), file("new/empty", 0, ""), file("new/notes.txt", 9, "")}
+		listB := []fileEntry{file("old/empty", 0, ""), file("old/other.txt", 8, ""), file("old/report.pdf", 100, ""), file("old/notes.txt", 9, "")}
+		diffs := computeDiff(listA, listB, rootA, rootB, options{})
+
+		kinds := map[string]diffKind{}
+		for _, d := range diffs {
+			kinds[d.relPath] = d.kind
+			if d.kind == diffRenamed && d.entryB.relPath != "old/report.pdf" {
+				t.Errorf("%s renamed from %s, want old/report.pdf", d.relPath, d.entryB.relPath)
+			}
+		}
+		want := map[string]diffKind{
+			"new/report.pdf": diffRenamed,
+			"new/other.txt":  diffOnlyA,
+			"new/empty":      diffOnlyA,
+			"new/notes.txt":  diffOnlyA,
+			"old/other.txt":  diffOnlyB,
+			"old/empty":      diffOnlyB,
+			"old/notes.txt":  diffOnlyB,
+		}
+		if len(kinds) != len(want) {
+			t.Fatalf("diffs = %v, want %v", kinds, want)
+		}
+		for p, k := range want {
+			if kinds[p] != k {
+				t.Errorf("%s: kind = %d, want %d", p, kinds[p], k)
+			}
+		}
+	})
+
+	t.Run("against a manifest", func(t *testing.T) {
+		listA := []fileEntry{file("new/report.pdf", 100, "")}
+		listB := []fileEntry{file("old/report.pdf", 100, "")}
+		diffs := computeDiff(listA, listB, t.TempDir(), filepath.Join(t.TempDir(), "snap.json"), options{manifest: true})
+		if len(diffs) != 1 || diffs[0].kind != diffRenamed || diffs[0].entryB.relPath != "old/report.pdf" {
+			t.Fatalf("diffs = %+v, want new/report.pdf renamed from old/report.pdf", diffs)
+		}
+	})
+
+	t.Run("by hash", func(t *testing.T) {
+		listA := []fileEntry{file("a/one.txt", 5, "h1"), file("a/two.txt", 5, "h2")}
+		listB := []fileEntry{file("b/renamed.txt", 5, "h2"), file("b/x.txt", 5, "h3")}
+		diffs := computeDiff(listA, listB, "/tmp/a", "/tmp/b", options{useHashes: true})
+
+		var renamed []diffEntry
+		for _, d := range diffs {
+			if d.kind == diffRenamed {
+				renamed = append(renamed, d)
+			}
+		}
+		if len(renamed) != 1 || renamed[0].relPath != "a/two.txt" || renamed[0].entryB.relPath != "b/renamed.txt" {
+			t.Fatalf("renamed = %+v, want a/two.txt from b/renamed.txt", renamed)
+		}
+		if len(diffs) != 3 {
+			t.Errorf("got %d diffs, want 3", len(diffs))
+		}
+	})
+}
+
+func TestComputeDiff_Symlinks(t *testing.T) {
+	link := func(path, target string, dangling bool) fileEntry {
+		return fileEntry{relPath: path, info: fakeInfo{size: int64(len(target)), mode: os.ModeSymlink | 0777}, target: target, dangling: dangling}
+	}
+	listA := []fileEntry{link("both", "lost", true), link("cfg", "conf.v1", false), link("gone", "x", true), link("moved", "old", true), link("same", "t", false)}
+	listB := []fileEntry{link("both", "lost", true), link("cfg", "conf.v2", false), link("gone", "x", false), link("moved", "new", true), link("only-b", "nowhere", true), link("same", "t", false)}
+
+	diffs := computeDiff(listA, listB, "/tmp/a", "/tmp/b", options{})
+	got := map[string]string{}
+	kinds := map[string]diffKind{}
+	for _, d := range diffs {
+		got[d.relPath] = detailString(d.details)
+		kinds[d.relPath] = d.kind
+	}
+
+	if kinds["cfg"] != diffChanged || got["cfg"] != "target" {
+		t.Errorf("cfg: kind %d detail %q, want changed target", kinds["cfg"], got["cfg"])
+	}
+	if kinds["gone"] != diffDangling || got["gone"] != "dangling in A" {
+		t.Errorf("gone: kind %d detail %q, want dangling in A", kinds["gone"], got["gone"])
+	}
+	if kinds["only-b"] != diffDangling || got["only-b"] != "dangling in B" {
+		t.Errorf("only-b: kind %d detail %q, want dangling in B", kinds["only-b"], got["only-b"])
+	}
+	if _, ok := got["same"]; ok {
+		t.Error("identical symlinks were reported as a difference")
+	}
+	if _, ok := got["both"]; ok {
+		t.Error("the same dangling link on both sides was reported as a difference")
+	}
+	if kinds["moved"] != diffDangling || got["moved"] != "dangling in both target" {
+		t.Errorf("moved: kind %d detail %q, want dangling in both with a target change", kinds["moved"], got["moved"])
+	}
+}
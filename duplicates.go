@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type dupGroup struct {
+	hash   string
+	size   int64
+	copies int
+	paths  []string
+}
+
+// wasted is the space taken by every copy beyond the first.
+func (g dupGroup) wasted() int64 {
+	return g.size * int64(g.copies-1)
+}
+
+// countCopies counts hard-linked names of one inode as a single copy.
+func countCopies(entries []*fileEntry) int {
+	seen := make(map[string]bool)
+	n := 0
+	for _, e := range entries {
+		if e.linkID != "" {
+			if seen[e.linkID] {
+				continue
+			}
+			seen[e.linkID] = true
+		}
+		n++
+	}
+	return n
+}
+
+type dupReport struct {
+	withinA []dupGroup
+	withinB []dupGroup
+	across  []dupGroup
+}
+
+// findDuplicates groups non-empty regular files by hash.
+func findDuplicates(listA, listB []fileEntry) dupReport {
+	byHash := func(list []fileEntry) map[string][]*fileEntry {
+		m := make(map[string][]*fileEntry)
+		for i := range list {
+			e := &list[i]
+			if e.hash == "" || !e.info.Mode().IsRegular() || e.info.Size() == 0 {
+				continue
+			}
+			m[e.hash] = append(m[e.hash], e)
+		}
+		return m
+	}
+	hashesA := byHash(listA)
+	hashesB := byHash(listB)
+
+	var r dupReport
+	r.withinA = groupsWithin(hashesA)
+	r.withinB = groupsWithin(hashesB)
+
+	for h, inA := range hashesA {
+		inB, ok := hashesB[h]
+		// Content at the same paths on both sides is the mirror working.
+		if !ok || samePaths(inA, inB) {
+			continue
+		}
+		copies := countCopies(append(append([]*fileEntry{}, inA...), inB...))
+		if copies < 2 {
+			continue
+		}
+		g := dupGroup{hash: h, size: inA[0].info.Size(), copies: copies}
+		for _, e := range inA {
+			g.paths = append(g.paths, "A:"+e.relPath)
+		}
+		for _, e := range inB {
+			g.paths = append(g.paths, "B:"+e.relPath)
+		}
+		r.across = append(r.across, g)
+	}
+	sortDupGroups(r.across)
+	return r
+}
+
+func groupsWithin(byHash map[string][]*fileEntry) []dupGroup {
+	var groups []dupGroup
+	for h, entries := range byHash {
+		copies := countCopies(entries)
+		if copies < 2 {
+			continue
+		}
+		g := dupGroup{hash: h, size: entries[0].info.Size(), copies: copies}
+		for _, e := range entries {
+			g.paths = append(g.paths, e.relPath)
+		}
+		groups = append(groups, g)
+	}
+	sortDupGroups(groups)
+	return groups
+}
+
+func samePaths(a, b []*fileEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].relPath != b[i].relPath {
+			return false
+		}
+	}
+	return true
+}
+
+// sortDupGroups puts the groups that waste the most space first.
+func sortDupGroups(groups []dupGroup) {
+	for _, g := range groups {
+		sort.Strings(g.paths)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if wi, wj := groups[i].wasted(), groups[j].wasted(); wi != wj {
+			return wi > wj
+		}
+		return groups[i].paths[0] < groups[j].paths[0]
+	})
+}
+
+func printDuplicates(out io.Writer, r dupReport) {
+	sections := []struct {
+		title  string
+		groups []dupGroup
+	}{
+		{"Duplicates in A", r.withinA},
+		{"Duplicates in B", r.withinB},
+		{"Duplicates across A and B", r.across},
+	}
+
+	var summary []string
+	for _, s := range sections {
+		if len(s.groups) == 0 {
+			continue
+		}
+		var total int64
+		fmt.Fprintln(out, colorCyan(fmt.Sprintf("=== %s ===", s.title)))
+		for _, g := range s.groups {
+			total += g.wasted()
+			fmt.Fprintln(out, colorYellow(fmt.Sprintf("  %s  %d copies of %d bytes, %d bytes wasted",
+				truncHash(g.hash), g.copies, g.size, g.wasted())))
+			for _, p := range g.paths {
+				fmt.Fprintf(out, "      %s\n", p)
+			}
+		}
+		fmt.Fprintln(out)
+		summary = append(summary, fmt.Sprintf("%d groups %s wasting %d bytes",
+			len(s.groups), strings.TrimPrefix(s.title, "Duplicates "), total))
+	}
+
+	if len(summary) == 0 {
+		fmt.Fprintln(out, "Duplicates: none found")
+		return
+	}
+	fmt.Fprintf(out, "Duplicates: %s\n", strings.Join(summary, ", "))
+}
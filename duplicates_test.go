@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	file := func(path string, size int64, hash string) fileEntry {
+		return fileEntry{relPath: path, info: fakeInfo{size: size, mode: 0644}, hash: hash}
+	}
+	linked := func(path string, size int64, hash, linkID string) fileEntry {
+		e := file(path, size, hash)
+		e.linkID = linkID
+		return e
+	}
+	listA := []fileEntry{
+		file("draft-final.docx", 100, "d"),
+		file("draft.docx", 100, "d"),
+		file("empty1", 0, "e"),
+		file("empty2", 0, "e"),
+		file("notes.txt", 10, "n"),
+		file("photo.jpg", 500, "p"),
+		linked("t1", 2, "t", "1:10"),
+		linked("hl", 2, "t", "1:10"),
+	}
+	listB := []fileEntry{
+		file("draft.docx", 100, "d"),
+		file("notes.txt", 10, "n"),
+		file("old/photo.jpg", 500, "p"),
+		file("x.bin", 7, "x"),
+		file("y.bin", 7, "x"),
+		linked("z.bin", 7, "x", "1:20"),
+		linked("z-link.bin", 7, "x", "1:20"),
+	}
+
+	r := findDuplicates(listA, listB)
+
+	if len(r.withinA) != 1 || strings.Join(r.withinA[0].paths, ",") != "draft-final.docx,draft.docx" {
+		t.Errorf("withinA = %+v, want the two drafts (empty files skipped)", r.withinA)
+	}
+	if len(r.withinB) != 1 || r.withinB[0].wasted() != 14 {
+		t.Errorf("withinB = %+v, want x.bin, y.bin and the z.bin inode wasting 14 bytes", r.withinB)
+	}
+
+	var got []string
+	for _, g := range r.across {
+		got = append(got, strings.Join(g.paths, ","))
+	}
+	want := []string{
+		"A:photo.jpg,B:old/photo.jpg",
+		"A:draft-final.docx,A:draft.docx,B:draft.docx",
+	}
+	if strings.Join(got, " | ") != strings.Join(want, " | ") {
+		t.Errorf("across = %v, want %v", got, want)
+	}
+}
+
+func TestPrintDuplicates(t *testing.T) {
+	var buf bytes.Buffer
+	printDuplicates(&buf, dupReport{})
+	if !strings.Contains(buf.String(), "none found") {
+		t.Errorf("empty report = %q, want 'none found'", buf.String())
+	}
+
+	buf.Reset()
+	printDuplicates(&buf, dupReport{withinA: []dupGroup{{hash: "abc", size: 10, copies: 3, paths: []string{"a", "b", "c"}}}})
+	out := buf.String()
+	for _, s := range []string{"Duplicates in A", "3 copies of 10 bytes, 20 bytes wasted", "1 groups in A wasting 20 bytes"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("report missing %q:\n%s", s, out)
+		}
+	}
+}
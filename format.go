@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"strings"
@@ -111,7 +112,7 @@ func sortDiffEntries(entries []diffEntry) {
 }
 
 func printDiffs(diffs []diffEntry, opts options) {
-	var onlyA, onlyB, changed, synced []diffEntry
+	var onlyA, onlyB, changed, renamed, dangling, synced []diffEntry
 	for _, d := range diffs {
 		switch d.kind {
 		case diffOnlyA:
@@ -120,6 +121,10 @@ func printDiffs(diffs []diffEntry, opts options) {
 			onlyB = append(onlyB, d)
 		case diffChanged:
 			changed = append(changed, d)
+		case diffRenamed:
+			renamed = append(renamed, d)
+		case diffDangling:
+			dangling = append(dangling, d)
 		case diffSynced:
 			synced = append(synced, d)
 		}
@@ -128,10 +133,13 @@ func printDiffs(diffs []diffEntry, opts options) {
 	sortDiffEntries(onlyA)
 	sortDiffEntries(onlyB)
 	sortDiffEntries(changed)
+	sortDiffEntries(renamed)
+	sortDiffEntries(dangling)
 
 	w := termWidth()
 
 	allDiffs := append(append(onlyA, onlyB...), changed...)
+	allDiffs = append(append(allDiffs, renamed...), dangling...)
 	detailMax := minDetailCol
 	for _, d := range allDiffs {
 		s := detailString(d.details)
@@ -201,36 +209,115 @@ func printDiffs(diffs []diffEntry, opts options) {
 				detail = firstDetail(d.details)
 			}
 			fmt.Println(colorYellow(fmt.Sprintf("  %s  %-*s  %-*s  %-*s  %8d  %8d",
-				"~", detailMax, detail, groupMax, truncatePath(group, groupMax), fileMax, truncatePath(file, fileMax), d.entryA.info.Size(), d.entryB.info.Size())))
+				sideSymbol(d.side), detailMax, detail, groupMax, truncatePath(group, groupMax), fileMax, truncatePath(file, fileMax), d.entryA.info.Size(), d.entryB.info.Size())))
 			if opts.verbose && len(d.docxDetails) > 0 {
 				for _, dd := range d.docxDetails {
 					fmt.Println(colorYellow(fmt.Sprintf("      %-8s  %s  (%s)",
 						categoryLabel(dd.category), dd.name, dd.reason)))
-					if len(dd.textDiff) > 0 {
-						for _, line := range dd.textDiff {
-							if strings.HasPrefix(line, "  -") {
-								fmt.Println(colorRed(line))
-							} else if strings.HasPrefix(line, "  +") {
-								fmt.Println(colorGreen(line))
-							} else {
-								fmt.Println(line)
-							}
-						}
-					}
+					printTextDiff(os.Stdout, dd.textDiff)
 				}
 			}
 		}
+		for _, d := range changed {
+			if d.side != sideUnknown {
+				fmt.Println(colorCyan("  > changed in A   < changed in B   ! conflict: both changed since last match"))
+				break
+			}
+		}
+		fmt.Println()
+	}
+
+	if len(renamed) > 0 {
+		fmt.Println(colorCyan("=== Renamed ==="))
+		fmt.Println(colorCyan(header))
+		fmt.Println(colorCyan(sep))
+		for _, d := range renamed {
+			group, _ := splitGroupAndFile(d.relPath)
+			file := renamedPath(d)
+			detail := detailString(d.details)
+			if len(detail) > detailMax {
+				detail = firstDetail(d.details)
+			}
+			fmt.Println(colorYellow(fmt.Sprintf("  %s  %-*s  %-*s  %-*s  %8d  %8d",
+				"R", detailMax, detail, groupMax, truncatePath(group, groupMax), fileMax, truncatePath(file, fileMax), d.entryA.info.Size(), d.entryB.info.Size())))
+		}
+		fmt.Println()
+	}
+
+	if len(dangling) > 0 {
+		fmt.Println(colorCyan("=== Dangling symlinks ==="))
+		fmt.Println(colorCyan(header))
+		fmt.Println(colorCyan(sep))
+		for _, d := range dangling {
+			e := d.entryA
+			if e == nil || !e.dangling {
+				e = d.entryB
+			}
+			group, file := splitGroupAndFile(d.relPath)
+			file += " -> " + e.target
+			detail := detailString(d.details)
+			if len(detail) > detailMax {
+				detail = firstDetail(d.details)
+			}
+			fmt.Println(colorRed(fmt.Sprintf("  %s  %-*s  %-*s  %-*s  %8s  %8s",
+				"D", detailMax, detail, groupMax, truncatePath(group, groupMax), fileMax, truncatePath(file, fileMax), entrySize(d.entryA), entrySize(d.entryB))))
+		}
 		fmt.Println()
 	}
 
+	conflicts := 0
+	for _, d := range changed {
+		if d.side == sideBoth {
+			conflicts++
+		}
+	}
+
 	fmt.Printf("Summary: %d only in A, %d only in B, %d changed",
 		len(onlyA), len(onlyB), len(changed))
+	if conflicts > 0 {
+		fmt.Printf(" (%d conflicts: both sides changed)", conflicts)
+	}
+	if len(renamed) > 0 {
+		fmt.Printf(", %d renamed", len(renamed))
+	}
+	if len(dangling) > 0 {
+		fmt.Printf(", %d dangling", len(dangling))
+	}
 	if len(synced) > 0 {
 		fmt.Printf(", %d synced", len(synced))
 	}
 	fmt.Println()
 }
 
+func entrySize(e *fileEntry) string {
+	if e == nil {
+		return "-"
+	}
+	return fmt.Sprint(e.info.Size())
+}
+
+// renamedPath keeps its arrow ASCII so byte-based padding lines up.
+func renamedPath(d diffEntry) string {
+	group, file := splitGroupAndFile(d.relPath)
+	oldGroup, oldFile := splitGroupAndFile(d.entryB.relPath)
+	if oldGroup == group {
+		return oldFile + " -> " + file
+	}
+	return d.entryB.relPath + " -> " + file
+}
+
+func printTextDiff(out io.Writer, lines []string) {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "  -") {
+			fmt.Fprintln(out, colorRed(line))
+		} else if strings.HasPrefix(line, "  +") {
+			fmt.Fprintln(out, colorGreen(line))
+		} else {
+			fmt.Fprintln(out, line)
+		}
+	}
+}
+
 func shortDetails(details []string) []string {
 	hasDocx := false
 	for _, d := range details {
@@ -251,6 +338,14 @@ func shortDetails(details []string) []string {
 			short = append(short, "mode")
 		} else if strings.HasPrefix(d, "hash:") {
 			short = append(short, "hash")
+		} else if strings.HasPrefix(d, "content:") {
+			short = append(short, "content")
+		} else if strings.HasPrefix(d, "name:") {
+			short = append(short, "name")
+		} else if strings.HasPrefix(d, "type:") {
+			short = append(short, "type")
+		} else if strings.HasPrefix(d, "target:") {
+			short = append(short, "target")
 		} else if strings.HasPrefix(d, "modified:") {
 			short = append(short, "date")
 		} else if strings.HasPrefix(d, "docx:") {
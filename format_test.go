@@ -59,6 +59,7 @@ func TestShortDetails(t *testing.T) {
 		{"size with docx suppressed", []string{"size: 10 vs 20", "docx:text"}, []string{"docx:text"}},
 		{"mode", []string{"mode: 0644 vs 0755"}, []string{"mode"}},
 		{"hash", []string{"hash: abc vs def"}, []string{"hash"}},
+		{"content", []string{"content: differs at byte 3"}, []string{"content"}},
 		{"modified", []string{"modified: 2026-01-01 vs 2026-01-02"}, []string{"date"}},
 		{"mixed", []string{"mode: 0644 vs 0755", "size: 10 vs 20"}, []string{"mode", "size"}},
 	}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type gitRepo struct {
+	top       string
+	gitDir    string
+	commonDir string // differs from gitDir only in a linked worktree
+}
+
+// findGitRepo walks up from dir to the nearest .git directory or file.
+func findGitRepo(dir string) (gitRepo, bool) {
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			repo := gitRepo{top: dir, gitDir: dotGit}
+			if !info.IsDir() {
+				target, ok := readGitFile(dotGit)
+				if !ok {
+					return gitRepo{}, false
+				}
+				repo.gitDir = target
+			}
+			repo.commonDir = repo.gitDir
+			if data, err := os.ReadFile(filepath.Join(repo.gitDir, "commondir")); err == nil {
+				repo.commonDir = resolveFrom(repo.gitDir, strings.TrimSpace(string(data)))
+			}
+			return repo, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return gitRepo{}, false
+		}
+		dir = parent
+	}
+}
+
+func readGitFile(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", false
+	}
+	return resolveFrom(filepath.Dir(path), strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))), true
+}
+
+func resolveFrom(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// excludesFile returns core.excludesFile or git's default $XDG_CONFIG_HOME/git/ignore.
+func (r gitRepo) excludesFile() string {
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	var configs []string
+	if xdg != "" {
+		configs = append(configs, filepath.Join(xdg, "git", "config"))
+	}
+	if home != "" {
+		configs = append(configs, filepath.Join(home, ".gitconfig"))
+	}
+	configs = append(configs, filepath.Join(r.commonDir, "config"))
+
+	value := ""
+	for _, c := range configs {
+		if v, ok := readGitConfigValue(c, "core", "excludesfile"); ok {
+			value = v
+		}
+	}
+	switch {
+	case value == "":
+		if xdg == "" {
+			return ""
+		}
+		return filepath.Join(xdg, "git", "ignore")
+	case strings.HasPrefix(value, "~/") && home != "":
+		return filepath.Join(home, value[2:])
+	}
+	return value
+}
+
+// readGitConfigValue returns the last setting of section.key; subsections are unsupported.
+func readGitConfigValue(path, section, key string) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	var value string
+	found := false
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				continue
+			}
+			current = strings.ToLower(strings.TrimSpace(line[1:end]))
+			continue
+		}
+		if current != section {
+			continue
+		}
+		name, v, _ := strings.Cut(line, "=")
+		if strings.ToLower(strings.TrimSpace(name)) != key {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if i := strings.IndexAny(v, "#;"); i >= 0 && !strings.HasPrefix(v, `"`) {
+			v = strings.TrimSpace(v[:i])
+		}
+		value, found = strings.Trim(v, `"`), true
+	}
+	return value, found
+}
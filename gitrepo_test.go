@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestIgnorer_GitExcludes mirrors what git ls-files --others
+// --exclude-standard reports for the same layout.
+func TestIgnorer_GitExcludes(t *testing.T) {
+	home := isolateGitConfig(t)
+	repo := t.TempDir()
+	writeTestFile(t, filepath.Join(home, ".config", "git", "ignore"), "*.log\n*.tmp\n")
+	writeTestTree(t, repo, map[string]string{
+		".git/info/exclude": "!keep.log\nsecret.txt\n/sub/only.txt\n",
+		".gitignore":        "!secret.txt\n",
+		"sub/.gitignore":    "x.tmp\n",
+	})
+
+	check := func(ig *ignorer, want map[string]bool) {
+		t.Helper()
+		for path, excluded := range want {
+			if got := ig.isExcluded(filepath.FromSlash(path), filepath.FromSlash(path), false); got != excluded {
+				t.Errorf("isExcluded(%q) = %v, want %v", path, got, excluded)
+			}
+		}
+	}
+
+	check(newIgnorer(nil, repo, filterRules{}), map[string]bool{
+		"keep.log":     false,
+		"other.log":    true,
+		"secret.txt":   false,
+		"only.txt":     false,
+		"sub/only.txt": true,
+		"sub/a.tmp":    true,
+	})
+	check(newIgnorer(nil, filepath.Join(repo, "sub"), filterRules{}), map[string]bool{
+		"only.txt": true,
+		"a.tmp":    true,
+		"b.log":    true,
+		"b.txt":    false,
+	})
+
+	writeTestFile(t, filepath.Join(repo, ".git", "config"), "[core]\n\texcludesFile = ~/custom-ignore\n")
+	writeTestFile(t, filepath.Join(home, "custom-ignore"), "*.txt\n")
+	check(newIgnorer(nil, repo, filterRules{}), map[string]bool{
+		"other.log":  false,
+		"only.txt":   true,
+		"secret.txt": false,
+	})
+
+	outside := t.TempDir()
+	if _, ok := findGitRepo(outside); !ok && newIgnorer(nil, outside, filterRules{}).isExcluded("a.log", "a.log", false) {
+		t.Error("global excludes applied outside a git repository")
+	}
+}
+
+func TestFindGitRepo_GitFile(t *testing.T) {
+	base := t.TempDir()
+	gitDir := filepath.Join(base, "main", ".git", "worktrees", "wt")
+	if err := os.MkdirAll(gitDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "commondir"), []byte("../..\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wt := filepath.Join(base, "wt")
+	if err := os.MkdirAll(filepath.Join(wt, "deep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wt, ".git"), []byte("gitdir: "+gitDir+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, ok := findGitRepo(filepath.Join(wt, "deep"))
+	if !ok {
+		t.Fatal("findGitRepo did not find the worktree")
+	}
+	if repo.top != wt || repo.gitDir != gitDir || repo.commonDir != filepath.Join(base, "main", ".git") {
+		t.Errorf("findGitRepo = %+v, want top %s, gitDir %s and the main .git as commonDir", repo, wt, gitDir)
+	}
+}
@@ -4,13 +4,47 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
+// pathFilter decides which entries a walk skips.
+type pathFilter interface {
+	isExcluded(relPath, rawPath string, isDir bool) bool
+}
+
+// differIgnoreFile holds gitignore-style rules that apply only to differ.
+const differIgnoreFile = ".differignore"
+
+// ignorer reads each directory's ignore files on first use; concurrent walks share them.
 type ignorer struct {
 	alwaysExclude map[string]bool
-	patterns      map[string][]ignorePattern
+	outer         []patternSet
+	cli           []ignorePattern
+	noGitignore   bool
+	root          string
+
+	mu   sync.Mutex
+	dirs map[string]*dirRules
+}
+
+// dirRules holds the patterns read from one directory's ignore files.
+type dirRules struct {
+	once      sync.Once
+	gitignore []ignorePattern
+	differ    []ignorePattern
+}
+
+type filterRules struct {
+	cli         []ignorePattern // --exclude and --include, in command-line order
+	noGitignore bool
+}
+
+type patternSet struct {
+	base     string // from the patterns' own directory to the tree root
+	patterns []ignorePattern
 }
 
 type ignorePattern struct {
@@ -20,204 +54,310 @@ type ignorePattern struct {
 	anchored bool
 }
 
-func newIgnorer(alwaysExclude []string, sourceRoot string) *ignorer {
+func newIgnorer(alwaysExclude []string, sourceRoot string, rules filterRules) *ignorer {
 	ae := make(map[string]bool)
 	for _, e := range alwaysExclude {
 		ae[e] = true
 	}
 	ig := &ignorer{
 		alwaysExclude: ae,
-		patterns:      make(map[string][]ignorePattern),
+		cli:           rules.cli,
+		noGitignore:   rules.noGitignore,
+		root:          sourceRoot,
+		dirs:          make(map[string]*dirRules),
+	}
+	if !rules.noGitignore {
+		ig.loadGitExcludes(sourceRoot)
 	}
-	ig.preload(sourceRoot)
 	return ig
 }
 
-func (ig *ignorer) preload(root string) {
-	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", path, err)
-			return nil
+// isExcluded keeps a path under an excluded directory excluded, as git does.
+func (ig *ignorer) isExcluded(relPath, rawPath string, isDir bool) bool {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	rawParts := strings.Split(filepath.ToSlash(rawPath), "/")
+	if len(rawParts) != len(parts) {
+		rawParts = parts
+	}
+	for i := 1; i <= len(parts); i++ {
+		dir := i < len(parts) || isDir
+		if ig.excludedHere(parts[:i], rawParts[:i], dir) {
+			return !ig.reopened(parts, isDir, i)
 		}
-		if info.IsDir() {
-			name := filepath.Base(path)
-			if ig.alwaysExclude[name] && path != root {
-				return filepath.SkipDir
-			}
-			rel, err := filepath.Rel(root, path)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "warning: cannot compute relative path for %s: %v\n", path, err)
-				return nil
-			}
-			ig.loadGitignore(path, rel)
-			return nil
+	}
+	return false
+}
+
+// reopened reports whether an --include keeps parts although parts[:from] is excluded.
+func (ig *ignorer) reopened(parts []string, isDir bool, from int) bool {
+	for k := from; k <= len(parts); k++ {
+		dir := k < len(parts) || isDir
+		rel := strings.Join(parts[:k], "/")
+		if !applyPatterns(ig.cli, rel, parts[k-1], dir, true) {
+			return true
 		}
-		return nil
-	})
+		if k == len(parts) {
+			return dir && ig.leadsToInclude(parts)
+		}
+		if !ig.leadsToInclude(parts[:k]) {
+			return false
+		}
+	}
+	return false
+}
+
+// leadsToInclude reports whether an anchored --include names a path below parts.
+func (ig *ignorer) leadsToInclude(parts []string) bool {
+	for _, p := range ig.cli {
+		if p.negated && p.anchored && prefixMatches(strings.Split(p.pattern, "/"), parts) {
+			return true
+		}
+	}
+	return false
 }
 
-func (ig *ignorer) isExcluded(relPath string, isDir bool) bool {
-	name := filepath.Base(relPath)
+func prefixMatches(pat, parts []string) bool {
+	for i, name := range parts {
+		if i >= len(pat) {
+			return false
+		}
+		if pat[i] == "**" {
+			return true
+		}
+		if !matchSegment(pat[i], name) {
+			return false
+		}
+	}
+	return len(pat) > len(parts)
+}
+
+// excludedHere judges the entry itself, not its ancestors; the last matching pattern wins.
+func (ig *ignorer) excludedHere(parts, rawParts []string, isDir bool) bool {
+	name := parts[len(parts)-1]
 	if ig.alwaysExclude[name] {
 		return true
 	}
 
-	dirParts := strings.Split(filepath.Dir(relPath), string(os.PathSeparator))
+	excluded := false
+	rel := strings.Join(parts, "/")
+	for _, set := range ig.outer {
+		excluded = applyPatterns(set.patterns, path.Join(set.base, rel), name, isDir, excluded)
+	}
 
-	dirs := []string{"."}
-	current := ""
-	for _, part := range dirParts {
-		if part == "." {
-			continue
+	// rules[depth] comes from the directory holding parts[depth].
+	rules := make([]*dirRules, len(parts))
+	dir := "."
+	for depth := range parts {
+		if depth > 0 {
+			dir = filepath.Join(dir, rawParts[depth-1])
 		}
-		if current == "" {
-			current = part
-		} else {
-			current = current + string(os.PathSeparator) + part
-		}
-		dirs = append(dirs, current)
+		rules[depth] = ig.rulesFor(dir)
+	}
+	for depth, r := range rules {
+		excluded = applyPatterns(r.gitignore, strings.Join(parts[depth:], "/"), name, isDir, excluded)
 	}
+	for depth, r := range rules {
+		excluded = applyPatterns(r.differ, strings.Join(parts[depth:], "/"), name, isDir, excluded)
+	}
+	return applyPatterns(ig.cli, rel, name, isDir, excluded)
+}
 
-	excluded := false
-	for _, dir := range dirs {
-		patterns, ok := ig.patterns[dir]
-		if !ok {
+// applyPatterns returns whether the entry is excluded after patterns.
+func applyPatterns(patterns []ignorePattern, relPath, name string, isDir bool, excluded bool) bool {
+	for _, p := range patterns {
+		if p.dirOnly && !isDir {
 			continue
 		}
-		for _, p := range patterns {
-			if p.dirOnly && !isDir {
-				continue
-			}
-			if matchPattern(p, relPath, name) {
-				if p.negated {
-					excluded = false
-				} else {
-					excluded = true
-				}
-			}
+		if matchPattern(p, relPath, name) {
+			excluded = !p.negated
 		}
 	}
-
 	return excluded
 }
 
-func (ig *ignorer) loadGitignore(absDir string, relDir string) {
-	gitignorePath := filepath.Join(absDir, ".gitignore")
-	f, err := os.Open(gitignorePath)
+// rulesFor reads rawDir's ignore files once, without blocking other directories.
+func (ig *ignorer) rulesFor(rawDir string) *dirRules {
+	ig.mu.Lock()
+	r, ok := ig.dirs[rawDir]
+	if !ok {
+		r = &dirRules{}
+		ig.dirs[rawDir] = r
+	}
+	ig.mu.Unlock()
+
+	r.once.Do(func() {
+		absDir := onDiskPath(ig.root, rawDir)
+		if !ig.noGitignore {
+			r.gitignore = readIgnoreFile(filepath.Join(absDir, ".gitignore"))
+		}
+		r.differ = readIgnoreFile(filepath.Join(absDir, differIgnoreFile))
+	})
+	return r
+}
+
+// loadGitExcludes adds git's rules from outside sourceRoot, lowest precedence first.
+func (ig *ignorer) loadGitExcludes(sourceRoot string) {
+	repo, ok := findGitRepo(sourceRoot)
+	if !ok {
+		return
+	}
+	rel, err := filepath.Rel(repo.top, sourceRoot)
 	if err != nil {
 		return
 	}
-	defer f.Close()
+	base := filepath.ToSlash(rel)
+	if base == "." {
+		base = ""
+	}
 
-	var patterns []ignorePattern
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
+	sources := []string{repo.excludesFile(), filepath.Join(repo.commonDir, "info", "exclude")}
+	for _, src := range sources {
+		if src == "" {
 			continue
 		}
-
-		p := ignorePattern{}
-
-		if strings.HasPrefix(line, "!") {
-			p.negated = true
-			line = line[1:]
+		if patterns := readIgnoreFile(src); len(patterns) > 0 {
+			ig.outer = append(ig.outer, patternSet{base: base, patterns: patterns})
 		}
+	}
 
-		if strings.HasSuffix(line, "/") {
-			p.dirOnly = true
-			line = strings.TrimSuffix(line, "/")
+	if base == "" {
+		return
+	}
+	dir := repo.top
+	parts := strings.Split(base, "/")
+	for i := range parts {
+		if patterns := readIgnoreFile(filepath.Join(dir, ".gitignore")); len(patterns) > 0 {
+			ig.outer = append(ig.outer, patternSet{base: strings.Join(parts[i:], "/"), patterns: patterns})
 		}
+		dir = filepath.Join(dir, parts[i])
+	}
+}
 
-		if strings.Contains(line, "/") {
-			p.anchored = true
-		}
+func readIgnoreFile(path string) []ignorePattern {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
 
-		p.pattern = line
-		patterns = append(patterns, p)
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := parseIgnoreLine(scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
 	}
 	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "warning: reading %s: %v\n", gitignorePath, err)
-	}
-
-	if len(patterns) > 0 {
-		ig.patterns[relDir] = patterns
+		fmt.Fprintf(os.Stderr, "warning: reading %s: %v\n", path, err)
 	}
+	return patterns
 }
 
-func matchPattern(p ignorePattern, relPath string, baseName string) bool {
-	pattern := p.pattern
-
-	if strings.Contains(pattern, "**") {
-		return matchDoublestar(pattern, relPath)
+// parseIgnoreLine parses one .gitignore line as described in gitignore(5).
+func parseIgnoreLine(line string) (ignorePattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
 	}
 
-	if p.anchored {
-		matched, _ := filepath.Match(pattern, relPath)
-		return matched
+	p := ignorePattern{}
+	switch {
+	case strings.HasPrefix(line, "!"):
+		p.negated = true
+		line = line[1:]
+	case strings.HasPrefix(line, "\\!"), strings.HasPrefix(line, "\\#"):
+		line = line[1:]
 	}
 
-	matched, _ := filepath.Match(pattern, baseName)
-	if matched {
-		return true
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
 	}
-
-	parts := strings.Split(relPath, string(os.PathSeparator))
-	for i := range parts {
-		sub := strings.Join(parts[i:], string(os.PathSeparator))
-		matched, _ = filepath.Match(pattern, sub)
-		if matched {
-			return true
-		}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
 	}
 
-	return false
+	p.pattern = line
+	return p, true
 }
 
-func matchDoublestar(pattern string, path string) bool {
-	if pattern == "**" {
-		return true
-	}
-
-	if strings.HasPrefix(pattern, "**/") {
-		rest := pattern[3:]
-		if matched, _ := filepath.Match(rest, path); matched {
-			return true
+// trimTrailingSpaces keeps a final space escaped with a backslash.
+func trimTrailingSpaces(line string) string {
+	end := len(line)
+	for end > 0 && line[end-1] == ' ' {
+		backslashes := 0
+		for i := end - 2; i >= 0 && line[i] == '\\'; i-- {
+			backslashes++
 		}
-		parts := strings.Split(path, string(os.PathSeparator))
-		for i := range parts {
-			sub := strings.Join(parts[i:], string(os.PathSeparator))
-			if matched, _ := filepath.Match(rest, sub); matched {
-				return true
-			}
+		if backslashes%2 == 1 {
+			break
 		}
-		return false
+		end--
 	}
+	return line[:end]
+}
 
-	if strings.HasSuffix(pattern, "/**") {
-		prefix := pattern[:len(pattern)-3]
-		return strings.HasPrefix(path, prefix+string(os.PathSeparator)) || path == prefix
+// matchPattern takes relPath relative to the directory that holds p.
+func matchPattern(p ignorePattern, relPath string, baseName string) bool {
+	if !p.anchored {
+		return matchSegment(p.pattern, baseName)
 	}
+	return matchDoublestar(p.pattern, filepath.ToSlash(relPath))
+}
+
+// matchDoublestar needs a trailing "**" to match at least one segment, so "dir/**" is not dir.
+func matchDoublestar(pattern string, path string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
 
-	idx := strings.Index(pattern, "/**/")
-	if idx >= 0 {
-		prefix := pattern[:idx]
-		suffix := pattern[idx+4:]
-		if !strings.HasPrefix(path, prefix+string(os.PathSeparator)) && path != prefix {
+func matchSegments(pat, path []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			if len(pat) == 1 {
+				return len(path) > 0
+			}
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pat[1:], path[i:]) {
+					return true
+				}
+			}
 			return false
 		}
-		rest := strings.TrimPrefix(path, prefix+string(os.PathSeparator))
-		if matched, _ := filepath.Match(suffix, rest); matched {
-			return true
+		if len(path) == 0 || !matchSegment(pat[0], path[0]) {
+			return false
 		}
-		parts := strings.Split(rest, string(os.PathSeparator))
-		for i := range parts {
-			sub := strings.Join(parts[i:], string(os.PathSeparator))
-			if matched, _ := filepath.Match(suffix, sub); matched {
-				return true
+		pat, path = pat[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// matchSegment reads "**" inside a segment as "*" and "[!...]" as "[^...]".
+func matchSegment(pattern, name string) bool {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			b.WriteByte(c)
+			b.WriteByte(pattern[i+1])
+			i++
+		case c == '*':
+			b.WriteByte('*')
+			for i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
 			}
+		case c == '[' && i+1 < len(pattern) && pattern[i+1] == '!':
+			b.WriteString("[^")
+			i++
+		default:
+			b.WriteByte(c)
 		}
 	}
-
-	return false
+	matched, err := path.Match(b.String(), name)
+	return err == nil && matched
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"path/filepath"
 	"testing"
 )
 
@@ -73,7 +74,7 @@ func TestMatchDoublestar(t *testing.T) {
 		{"**/file matches deep", "**/Makefile", "a/b/c/Makefile", true},
 		{"**/file no match", "**/Makefile", "src/main.go", false},
 		{"dir/**", "vendor/**", "vendor/pkg/mod", true},
-		{"dir/** exact", "vendor/**", "vendor", true},
+		{"dir/** is only the contents", "vendor/**", "vendor", false},
 		{"dir/** no match", "vendor/**", "src/vendor", false},
 		{"middle /**/", "src/**/test.go", "src/pkg/test.go", true},
 		{"middle /**/ deep", "src/**/test.go", "src/a/b/test.go", true},
@@ -91,7 +92,7 @@ func TestMatchDoublestar(t *testing.T) {
 }
 
 func TestIgnorer_IsExcluded(t *testing.T) {
-	ig := newIgnorer([]string{".git", "node_modules"}, "/nonexistent")
+	ig := newIgnorer([]string{".git", "node_modules"}, "/nonexistent", filterRules{})
 
 	tests := []struct {
 		name    string
@@ -106,7 +107,7 @@ func TestIgnorer_IsExcluded(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := ig.isExcluded(tt.relPath, tt.isDir)
+			got := ig.isExcluded(tt.relPath, tt.relPath, tt.isDir)
 			if got != tt.want {
 				t.Errorf("isExcluded(%q, %v) = %v, want %v",
 					tt.relPath, tt.isDir, got, tt.want)
@@ -114,3 +115,153 @@ func TestIgnorer_IsExcluded(t *testing.T) {
 		})
 	}
 }
+
+// TestIgnorer_GitConformance checks the ignorer against cases whose
+// expected results were recorded from git itself (git ls-files --others
+// --exclude-standard for files, git check-ignore for directories).
+func TestIgnorer_GitConformance(t *testing.T) {
+	isolateGitConfig(t)
+	tests := []struct {
+		name       string
+		gitignores map[string]string
+		path       string
+		isDir      bool
+		want       bool
+	}{
+		{"escaped hash", map[string]string{".gitignore": "\\#notes\n#comment\n"}, "#notes", false, true},
+		{"comment line ignores nothing", map[string]string{".gitignore": "#comment\n"}, "#comment", false, false},
+		{"escaped bang", map[string]string{".gitignore": "\\!important\n"}, "!important", false, true},
+		{"escaped trailing space kept", map[string]string{".gitignore": "trailing\\ \n"}, "trailing ", false, true},
+		{"escaped trailing space needs space", map[string]string{".gitignore": "trailing\\ \n"}, "trailing", false, false},
+		{"unescaped trailing spaces dropped", map[string]string{".gitignore": "spaces   \n"}, "spaces", false, true},
+		{"leading space is significant", map[string]string{".gitignore": " lead\n"}, "lead", false, false},
+		{"leading slash anchors to root", map[string]string{".gitignore": "/root.txt\n"}, "root.txt", false, true},
+		{"leading slash does not match nested", map[string]string{".gitignore": "/root.txt\n"}, "sub/root.txt", false, false},
+		{"nested leading slash anchors to its dir", map[string]string{"sub/.gitignore": "/local.txt\n"}, "sub/local.txt", false, true},
+		{"nested leading slash not deeper", map[string]string{"sub/.gitignore": "/local.txt\n"}, "sub/deeper/local.txt", false, false},
+		{"nested leading slash not at root", map[string]string{"sub/.gitignore": "/local.txt\n"}, "local.txt", false, false},
+		{"nested middle slash relative to its dir", map[string]string{"sub/.gitignore": "docs/api.md\n"}, "sub/docs/api.md", false, true},
+		{"nested middle slash not from root", map[string]string{"sub/.gitignore": "docs/api.md\n"}, "docs/api.md", false, false},
+		{"nested unanchored matches below it", map[string]string{"sub/.gitignore": "*.o\n"}, "sub/x/y.o", false, true},
+		{"nested unanchored not above it", map[string]string{"sub/.gitignore": "*.o\n"}, "y.o", false, false},
+		{"no re-include under excluded dir", map[string]string{".gitignore": "build/\n!build/keep.txt\n"}, "build/keep.txt", false, true},
+		{"no re-include under excluded dir by name", map[string]string{".gitignore": "build\n!keep.txt\n"}, "build/keep.txt", false, true},
+		{"re-include when only contents excluded", map[string]string{".gitignore": "logs/*\n!logs/keep.log\n"}, "logs/keep.log", false, false},
+		{"contents pattern still excludes others", map[string]string{".gitignore": "logs/*\n!logs/keep.log\n"}, "logs/other.log", false, true},
+		{"deeper gitignore re-includes", map[string]string{".gitignore": "*.txt\n", "sub/.gitignore": "!keep.txt\n"}, "sub/keep.txt", false, false},
+		{"negation order matters", map[string]string{".gitignore": "!a.log\n*.log\n"}, "a.log", false, true},
+		{"leading doublestar glob at root", map[string]string{".gitignore": "**/*.tmp\n"}, "a.tmp", false, true},
+		{"leading doublestar glob nested", map[string]string{".gitignore": "**/*.tmp\n"}, "x/y/b.tmp", false, true},
+		{"middle doublestar with glob", map[string]string{".gitignore": "src/**/gen_*.go\n"}, "src/x/y/gen_b.go", false, true},
+		{"middle doublestar zero dirs", map[string]string{".gitignore": "src/**/gen_*.go\n"}, "src/gen_a.go", false, true},
+		{"middle doublestar glob no match", map[string]string{".gitignore": "src/**/gen_*.go\n"}, "src/x/other.go", false, false},
+		{"two doublestars", map[string]string{".gitignore": "a/**/b/**/c.txt\n"}, "a/x/b/y/z/c.txt", false, true},
+		{"two doublestars adjacent dirs", map[string]string{".gitignore": "a/**/b/**/c.txt\n"}, "a/b/c.txt", false, true},
+		{"trailing doublestar contents", map[string]string{".gitignore": "vendor/**\n"}, "vendor/pkg/mod.go", false, true},
+		{"trailing doublestar allows re-include", map[string]string{".gitignore": "vendor/**\n!vendor/keep.go\n"}, "vendor/keep.go", false, false},
+		{"doublestar inside segment is a star", map[string]string{".gitignore": "foo**bar\n"}, "fooXbar", false, true},
+		{"doublestar inside segment stays in segment", map[string]string{".gitignore": "a/foo**bar\n"}, "a/foo/bar", false, false},
+		{"negated class", map[string]string{".gitignore": "[!a]*.md\n"}, "b.md", false, true},
+		{"negated class excludes member", map[string]string{".gitignore": "[!a]*.md\n"}, "a.md", false, false},
+		{"dir only skips files", map[string]string{".gitignore": "cache/\n"}, "cache", false, false},
+		{"dir only matches dirs", map[string]string{".gitignore": "cache/\n"}, "cache", true, true},
+		{"escaped star is literal", map[string]string{".gitignore": "\\*.txt\n"}, "*.txt", false, true},
+		{"escaped star does not glob", map[string]string{".gitignore": "\\*.txt\n"}, "a.txt", false, false},
+		{"question mark", map[string]string{".gitignore": "?.c\n"}, "x.c", false, true},
+		{"question mark not slash", map[string]string{".gitignore": "a?b\n"}, "a/b", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTestTree(t, root, tt.gitignores)
+			ig := newIgnorer(nil, root, filterRules{})
+			if got := ig.isExcluded(filepath.FromSlash(tt.path), filepath.FromSlash(tt.path), tt.isDir); got != tt.want {
+				t.Errorf("isExcluded(%q, %v) with %q = %v, want %v", tt.path, tt.isDir, tt.gitignores, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnorer_DifferignoreAndFlags(t *testing.T) {
+	isolateGitConfig(t)
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		".gitignore":        "*.log\nbuild/\n",
+		".differignore":     "*.pdf\n!keep.log\n",
+		"sub/.gitignore":    "!*.pdf\n",
+		"sub/.differignore": "local.txt\n",
+	})
+	exclude := func(pattern string) ignorePattern {
+		p, _ := parseIgnoreLine(pattern)
+		return p
+	}
+	include := func(pattern string) ignorePattern {
+		p := exclude(pattern)
+		p.negated = true
+		return p
+	}
+
+	tests := []struct {
+		name  string
+		rules filterRules
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"gitignore still applies", filterRules{}, "app.log", false, true},
+		{"differignore skips tracked file", filterRules{}, "doc.pdf", false, true},
+		{"differignore beats deeper gitignore", filterRules{}, "sub/doc.pdf", false, true},
+		{"differignore re-includes", filterRules{}, "keep.log", false, false},
+		{"nested differignore", filterRules{}, "sub/local.txt", false, true},
+		{"nested differignore stays local", filterRules{}, "local.txt", false, false},
+		{"exclude flag", filterRules{cli: []ignorePattern{exclude("*.go")}}, "src/main.go", false, true},
+		{"anchored exclude flag", filterRules{cli: []ignorePattern{exclude("/main.go")}}, "src/main.go", false, false},
+		{"include beats differignore", filterRules{cli: []ignorePattern{include("doc.pdf")}}, "doc.pdf", false, false},
+		{"include re-includes ignored dir", filterRules{cli: []ignorePattern{include("build/")}}, "build/out.bin", false, false},
+		{"last flag wins", filterRules{cli: []ignorePattern{include("*.pdf"), exclude("doc.pdf")}}, "doc.pdf", false, true},
+		{"include reopens excluded dir", filterRules{cli: []ignorePattern{exclude("node_modules"), include("node_modules/keep.js")}}, "node_modules", true, false},
+		{"include reaches into excluded dir", filterRules{cli: []ignorePattern{exclude("node_modules"), include("node_modules/keep.js")}}, "node_modules/keep.js", false, false},
+		{"reopened dir keeps other files out", filterRules{cli: []ignorePattern{exclude("node_modules"), include("node_modules/keep.js")}}, "node_modules/other.js", false, true},
+		{"reopened dir keeps other dirs out", filterRules{cli: []ignorePattern{exclude("node_modules"), include("node_modules/keep.js")}}, "node_modules/sub", true, true},
+		{"include of a reopened dir takes its contents", filterRules{cli: []ignorePattern{include("build/gen/")}}, "build/gen/a/b.txt", false, false},
+		{"unanchored include stays out of excluded dir", filterRules{cli: []ignorePattern{include("out.bin")}}, "build/out.bin", false, true},
+		{"no-gitignore drops gitignore", filterRules{noGitignore: true}, "app.log", false, false},
+		{"no-gitignore keeps differignore", filterRules{noGitignore: true}, "doc.pdf", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ig := newIgnorer(nil, root, tt.rules)
+			if got := ig.isExcluded(filepath.FromSlash(tt.path), filepath.FromSlash(tt.path), tt.isDir); got != tt.want {
+				t.Errorf("isExcluded(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIgnoreLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want ignorePattern
+		ok   bool
+	}{
+		{"", ignorePattern{}, false},
+		{"# comment", ignorePattern{}, false},
+		{"   ", ignorePattern{}, false},
+		{"/", ignorePattern{}, false},
+		{`\#hash`, ignorePattern{pattern: "#hash"}, true},
+		{`\!bang`, ignorePattern{pattern: "!bang"}, true},
+		{"!keep.txt", ignorePattern{pattern: "keep.txt", negated: true}, true},
+		{"build/", ignorePattern{pattern: "build", dirOnly: true}, true},
+		{"/root.txt", ignorePattern{pattern: "root.txt", anchored: true}, true},
+		{"doc/frotz/", ignorePattern{pattern: "doc/frotz", dirOnly: true, anchored: true}, true},
+		{"name  ", ignorePattern{pattern: "name"}, true},
+		{`name\ `, ignorePattern{pattern: `name\ `}, true},
+		{"crlf\r", ignorePattern{pattern: "crlf"}, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseIgnoreLine(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseIgnoreLine(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	appkit "github.com/TrueBlocks/trueblocks-art/packages/appkit/v2"
+)
+
+const journalFile = "journal.json"
+
+type journalAction struct {
+	Op       string      `json:"op"`
+	Path     string      `json:"path"`
+	From     string      `json:"from,omitempty"`
+	Trash    string      `json:"trash,omitempty"`
+	Created  bool        `json:"created,omitempty"`
+	OldMode  os.FileMode `json:"oldMode"`
+	Restored bool        `json:"restored,omitempty"`
+}
+
+type journal struct {
+	ID      string          `json:"id"`
+	Started time.Time       `json:"started"`
+	RootA   string          `json:"rootA"`
+	RootB   string          `json:"rootB"`
+	Undone  bool            `json:"undone,omitempty"`
+	Actions []journalAction `json:"actions"`
+	dir     string
+}
+
+func journalRoot() string {
+	dir := dataDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "journal")
+}
+
+func newJournal(rootA, rootB string) (*journal, error) {
+	root := journalRoot()
+	if root == "" {
+		return nil, fmt.Errorf("cannot determine data directory")
+	}
+
+	now := time.Now()
+	id := now.Format("20060102-150405")
+	dir := filepath.Join(root, id)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i)
+		dir = filepath.Join(root, id)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "trash"), 0755); err != nil {
+		return nil, err
+	}
+	j := &journal{ID: id, Started: now, RootA: rootA, RootB: rootB, dir: dir}
+	return j, j.save()
+}
+
+func (j *journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(j.dir, journalFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(j.dir, journalFile))
+}
+
+func (j *journal) record(a journalAction) {
+	j.Actions = append(j.Actions, a)
+	if err := j.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cannot save journal %s: %v\n", j.ID, err)
+	}
+}
+
+func (j *journal) preserve(path string) (journalAction, error) {
+	a := journalAction{Op: opCopy, Path: path}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		a.Created = true
+		return a, nil
+	}
+	if err != nil {
+		return a, err
+	}
+
+	a.OldMode = info.Mode()
+	a.Trash = filepath.Join("trash", fmt.Sprintf("%06d", len(j.Actions)+1))
+	if err := moveFile(path, filepath.Join(j.dir, a.Trash)); err != nil {
+		return a, fmt.Errorf("cannot move original to trash: %w", err)
+	}
+	return a, nil
+}
+
+func (j *journal) restore(a journalAction) {
+	if a.Trash == "" {
+		return
+	}
+	if err := moveFile(filepath.Join(j.dir, a.Trash), a.Path); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cannot restore %s from trash: %v\n", a.Path, err)
+	}
+}
+
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := appkit.CopyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func loadJournal(id string) (*journal, error) {
+	dir := filepath.Join(journalRoot(), id)
+	data, err := os.ReadFile(filepath.Join(dir, journalFile))
+	if err != nil {
+		return nil, err
+	}
+	var j journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("corrupt journal %s: %w", id, err)
+	}
+	j.dir = dir
+	return &j, nil
+}
+
+func listJournals() ([]*journal, error) {
+	dirEntries, err := os.ReadDir(journalRoot())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var journals []*journal
+	for _, de := range dirEntries {
+		if !de.IsDir() {
+			continue
+		}
+		j, err := loadJournal(de.Name())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			continue
+		}
+		journals = append(journals, j)
+	}
+	sort.Slice(journals, func(i, k int) bool {
+		return journals[i].Started.Before(journals[k].Started)
+	})
+	return journals, nil
+}
+
+func (j *journal) undo() int {
+	var failed int
+	for i := len(j.Actions) - 1; i >= 0; i-- {
+		if j.Actions[i].Restored {
+			continue
+		}
+		if err := j.undoAction(j.Actions[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "  undo error: %s: %s\n", j.Actions[i].Path, err)
+			failed++
+			continue
+		}
+		j.Actions[i].Restored = true
+		if err := j.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: cannot save journal %s: %v\n", j.ID, err)
+		}
+	}
+
+	if failed == 0 {
+		j.Undone = true
+		if err := j.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: cannot save journal %s: %v\n", j.ID, err)
+		}
+	}
+	return failed
+}
+
+func (j *journal) undoAction(a journalAction) error {
+	switch a.Op {
+	case opChmod:
+		if err := os.Chmod(a.Path, a.OldMode); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "  restored mode: %s → %s\n", a.Path, a.OldMode)
+	case opMkdir:
+		if err := os.Remove(a.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "  removed: %s\n", a.Path)
+	case opRmdir:
+		if err := os.Mkdir(a.Path, a.OldMode.Perm()); err != nil && !os.IsExist(err) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "  recreated: %s\n", a.Path)
+	case opRename:
+		if err := os.Rename(a.Path, a.From); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "  renamed back: %s → %s\n", a.Path, a.From)
+	case opCopy, opDelete:
+		trash := filepath.Join(j.dir, a.Trash)
+		if !a.Created {
+			if _, err := os.Lstat(trash); err != nil {
+				return fmt.Errorf("original is no longer in the trash: %w", err)
+			}
+		}
+		if a.Op == opCopy {
+			if err := os.Remove(a.Path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if a.Created {
+			fmt.Fprintf(os.Stderr, "  removed: %s\n", a.Path)
+			return nil
+		}
+		if err := moveFile(trash, a.Path); err != nil {
+			return err
+		}
+		if err := os.Chmod(a.Path, a.OldMode); err != nil {
+			fmt.Fprintf(os.Stderr, "  undo error: %s: %s\n", a.Path, err)
+		}
+		fmt.Fprintf(os.Stderr, "  restored: %s\n", a.Path)
+	}
+	return nil
+}
+
+func runUndo(cfg config, args []string) int {
+	var list bool
+	fs := newFlagSet("undo")
+	fs.BoolVar(&list, "list", false, "list recorded sync runs instead of undoing one")
+	positional, err := parseCommandLine(fs, args)
+	if err != nil {
+		return reportUsageError("undo", err)
+	}
+	if len(positional) > 1 {
+		return reportUsageError("undo", fmt.Errorf("too many arguments"))
+	}
+
+	journals, err := listJournals()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitUsageErr
+	}
+
+	if list {
+		for _, j := range journals {
+			state := ""
+			if j.Undone {
+				state = "  (undone)"
+			}
+			fmt.Printf("  %s  %3d actions  %s → %s%s\n", j.ID, len(j.Actions), j.RootA, j.RootB, state)
+		}
+		return exitOK
+	}
+
+	var target *journal
+	if len(positional) == 1 {
+		for _, j := range journals {
+			if j.ID == positional[0] {
+				target = j
+			}
+		}
+		if target == nil {
+			return reportUsageError("undo", fmt.Errorf("no sync run with id %q", positional[0]))
+		}
+		if target.Undone {
+			return reportUsageError("undo", fmt.Errorf("sync run %s was already undone", target.ID))
+		}
+	} else {
+		for i := len(journals) - 1; i >= 0; i-- {
+			if !journals[i].Undone && len(journals[i].Actions) > 0 {
+				target = journals[i]
+				break
+			}
+		}
+		if target == nil {
+			fmt.Println("Nothing to undo.")
+			return exitOK
+		}
+	}
+
+	failed := target.undo()
+	fmt.Printf("Summary: undid %d actions from %s", len(target.Actions)-failed, target.ID)
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+		fmt.Println()
+		return exitDiff
+	}
+	fmt.Println()
+	return exitOK
+}
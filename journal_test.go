@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal_UndoRestoresCopyAndChmod(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	rootA := t.TempDir()
+	rootB := t.TempDir()
+
+	write := func(root, name, content string, mode os.FileMode) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(rootA, "doc.docx", "new", 0644)
+	write(rootB, "doc.docx", "old", 0600)
+	write(rootA, "run.sh", "x", 0755)
+	write(rootB, "run.sh", "x", 0644)
+
+	diffs := []diffEntry{
+		{kind: diffChanged, relPath: "doc.docx"},
+		{kind: diffChanged, relPath: "run.sh", details: []string{"mode: -rwxr-xr-x vs -rw-r--r--"}},
+	}
+	actions := []syncAction{
+		{Op: opCopy, index: 0, Path: "doc.docx"},
+		{Op: opChmod, index: 1, Path: "run.sh", Mode: 0755},
+	}
+	applySync(diffs, actions, rootA, rootB)
+
+	if data, _ := os.ReadFile(filepath.Join(rootB, "doc.docx")); string(data) != "new" {
+		t.Fatalf("after sync doc.docx = %q, want %q", data, "new")
+	}
+
+	journals, err := listJournals()
+	if err != nil || len(journals) != 1 {
+		t.Fatalf("listJournals = %d journals, err %v; want 1", len(journals), err)
+	}
+	if failed := journals[0].undo(); failed != 0 {
+		t.Fatalf("undo reported %d failures", failed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootB, "doc.docx"))
+	if err != nil || string(data) != "old" {
+		t.Errorf("after undo doc.docx = %q (err %v), want %q", data, err, "old")
+	}
+	if info, err := os.Stat(filepath.Join(rootB, "doc.docx")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("after undo doc.docx mode = %v (err %v), want 0600", info.Mode().Perm(), err)
+	}
+	if info, err := os.Stat(filepath.Join(rootB, "run.sh")); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("after undo run.sh mode = %v (err %v), want 0644", info.Mode().Perm(), err)
+	}
+
+	reloaded, err := loadJournal(journals[0].ID)
+	if err != nil || !reloaded.Undone {
+		t.Errorf("journal not marked undone after undo (err %v)", err)
+	}
+}
+
+func TestJournal_UndoRemovesCreatedFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	rootB := t.TempDir()
+
+	j, err := newJournal("/a", rootB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(rootB, "fresh.txt")
+	a, err := j.preserve(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Created {
+		t.Fatal("preserve of a missing file should record it as created")
+	}
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j.record(a)
+
+	if failed := j.undo(); failed != 0 {
+		t.Fatalf("undo reported %d failures", failed)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("created file still exists after undo (err %v)", err)
+	}
+}
+
+func TestJournal_UndoResumesAfterFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	rootB := t.TempDir()
+
+	j, err := newJournal("/a", rootB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The chmod of a path that no longer exists fails on every run.
+	j.record(journalAction{Op: opChmod, Path: filepath.Join(rootB, "gone.sh"), OldMode: 0644})
+	for _, name := range []string{"one.txt", "two.txt"} {
+		path := filepath.Join(rootB, name)
+		if err := os.WriteFile(path, []byte("old "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		a, err := j.preserve(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("new"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		j.record(a)
+	}
+
+	for run := 1; run <= 2; run++ {
+		reloaded, err := loadJournal(j.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed := reloaded.undo(); failed != 1 {
+			t.Fatalf("run %d: undo reported %d failures, want 1", run, failed)
+		}
+		for _, name := range []string{"one.txt", "two.txt"} {
+			data, err := os.ReadFile(filepath.Join(rootB, name))
+			if err != nil || string(data) != "old "+name {
+				t.Errorf("run %d: %s = %q (err %v), want the original", run, name, data, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "dir"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "char device"
+	case mode&os.ModeDevice != 0:
+		return "block device"
+	default:
+		return "other"
+	}
+}
+
+// isSpecial reports entries that are compared but never copied.
+func isSpecial(mode os.FileMode) bool {
+	return mode&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice|os.ModeCharDevice|os.ModeIrregular) != 0
+}
+
+// hardLinkID returns "" unless a regular file has more than one name.
+func hardLinkID(info os.FileInfo) string {
+	if !info.Mode().IsRegular() || linkCount(info) < 2 {
+		return ""
+	}
+	dev, ino, ok := fileIdentity(info)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", dev, ino)
+}
+
+// linkGroups keys each set of walked names sharing one inode.
+func linkGroups(list []fileEntry) map[string]bool {
+	byID := make(map[string][]string)
+	for _, e := range list {
+		if e.linkID != "" {
+			byID[e.linkID] = append(byID[e.linkID], e.relPath)
+		}
+	}
+	groups := make(map[string]bool)
+	for _, paths := range byID {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			groups[strings.Join(paths, ", ")] = true
+		}
+	}
+	return groups
+}
+
+type linkDiff struct {
+	side  string
+	paths string
+}
+
+func compareLinkStructure(listA, listB []fileEntry) []linkDiff {
+	groupsA := linkGroups(listA)
+	groupsB := linkGroups(listB)
+
+	var diffs []linkDiff
+	for g := range groupsA {
+		if !groupsB[g] {
+			diffs = append(diffs, linkDiff{side: "A", paths: g})
+		}
+	}
+	for g := range groupsB {
+		if !groupsA[g] {
+			diffs = append(diffs, linkDiff{side: "B", paths: g})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].paths != diffs[j].paths {
+			return diffs[i].paths < diffs[j].paths
+		}
+		return diffs[i].side < diffs[j].side
+	})
+	return diffs
+}
+
+func printLinkStructure(out io.Writer, diffs []linkDiff) {
+	if len(diffs) == 0 {
+		fmt.Fprintln(out, "Hard links: same structure in A and B")
+		return
+	}
+	fmt.Fprintln(out, colorCyan("=== Hard links ==="))
+	for _, d := range diffs {
+		fmt.Fprintln(out, colorYellow(fmt.Sprintf("  linked only in %s: %s", d.side, d.paths)))
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Hard links: %d groups differ\n", len(diffs))
+}
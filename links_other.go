@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func linkCount(info os.FileInfo) uint64 {
+	return 1
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileType(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		want string
+	}{
+		{0644, "file"},
+		{os.ModeDir | 0755, "dir"},
+		{os.ModeSymlink | 0777, "symlink"},
+		{os.ModeNamedPipe | 0644, "fifo"},
+		{os.ModeSocket | 0755, "socket"},
+		{os.ModeDevice | os.ModeCharDevice | 0666, "char device"},
+		{os.ModeDevice | 0660, "block device"},
+	}
+	for _, tt := range tests {
+		if got := fileType(tt.mode); got != tt.want {
+			t.Errorf("fileType(%s) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestCompareEntries_TypeMismatch(t *testing.T) {
+	a := &fileEntry{relPath: "queue", info: fakeInfo{size: 10, mode: 0644}}
+	b := &fileEntry{relPath: "queue", info: fakeInfo{mode: os.ModeNamedPipe | 0644}}
+	changes, _ := compareEntries(a, b, "/tmp/a", "/tmp/b", options{})
+	if len(changes) != 1 || changes[0] != "type: file vs fifo" {
+		t.Errorf("changes = %v, want [type: file vs fifo]", changes)
+	}
+
+	fifo := &fileEntry{relPath: "p", info: fakeInfo{mode: os.ModeNamedPipe | 0600}}
+	if changes, _ := compareEntries(fifo, b, "/tmp/a", "/tmp/b", options{useHashes: true}); len(changes) != 1 || detailString(changes) != "mode" {
+		t.Errorf("fifo changes = %v, want only a mode change", changes)
+	}
+}
+
+func TestPlanSync_SkipsSpecialFiles(t *testing.T) {
+	fifo := fakeInfo{mode: os.ModeNamedPipe | 0600}
+	diffs := []diffEntry{
+		{kind: diffOnlyA, relPath: "pipe", entryA: &fileEntry{info: fifo}},
+		{kind: diffChanged, relPath: "pipe2", details: []string{"mode: prw------- vs prw-r--r--"},
+			entryA: &fileEntry{info: fifo}, entryB: &fileEntry{info: fakeInfo{mode: os.ModeNamedPipe | 0644}}},
+	}
+	for _, po := range []planOptions{{}, {full: true}} {
+		if actions := planSync(diffs, po); len(actions) != 0 {
+			t.Errorf("planSync(%+v) = %+v, want no actions for special files", po, actions)
+		}
+	}
+}
+
+func TestHardLinks(t *testing.T) {
+	rootA := t.TempDir()
+	rootB := t.TempDir()
+	for _, root := range []string{rootA, rootB} {
+		if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("shared"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "b.txt"), []byte("shared"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(filepath.Join(rootA, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(rootA, "a.txt"), filepath.Join(rootA, "b.txt")); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	lists, err := walkTrees([]string{rootA, rootB}, []string{"A", "B"}, newIgnorer(nil, rootA, filterRules{}), options{quiet: true, useHashes: true, noCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listA, listB := lists[0], lists[1]
+	if listA[0].linkID == "" || listA[0].linkID != listA[1].linkID {
+		t.Skip("platform does not report hard-link identity")
+	}
+	if listA[0].hash == "" || listA[0].hash != listA[1].hash || listA[0].hash != listB[0].hash {
+		t.Errorf("hashes = %q, %q, %q; want the same shared hash", listA[0].hash, listA[1].hash, listB[0].hash)
+	}
+	if listB[0].linkID != "" {
+		t.Errorf("B a.txt has linkID %q, want none", listB[0].linkID)
+	}
+
+	diffs := compareLinkStructure(listA, listB)
+	if len(diffs) != 1 || diffs[0].side != "A" || diffs[0].paths != "a.txt, b.txt" {
+		t.Errorf("compareLinkStructure = %+v, want a.txt, b.txt linked only in A", diffs)
+	}
+	if diffs := compareLinkStructure(listA, listA); len(diffs) != 0 {
+		t.Errorf("compareLinkStructure of a tree with itself = %+v, want none", diffs)
+	}
+}
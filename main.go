@@ -1,11 +1,11 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 )
 
 const (
@@ -18,127 +18,559 @@ type options struct {
 	useDate   bool
 	useHashes bool
 	verbose   bool
+	allCopies bool
+	quiet     bool
+	skipDocx  bool
+	sync      bool
+	dryRun    bool
+	review    bool
+	fullSync  bool
+	delete    bool
+	jsonOut   bool
+	jobs      int
+	noCache   bool
+	hashCache *hashCache
+	hashSlots chan struct{}
+	content   bool
+	noQuick   bool
+	dupes     bool
+	follow    bool
+	hardLinks bool
+	nameForms bool
+	ignorePol string
+	filters   filterRules
+	manifest  bool
+	noRenames bool
+}
+
+type comparison struct {
+	listA     []fileEntry
+	listB     []fileEntry
+	diffs     []diffEntry
+	base      *baseline
+	conflicts []ignoreConflict
+}
+
+type diffTarget struct {
+	pathA     string
+	pathB     string
+	suffix    int
+	opts      options
+	manifestA *manifest
+	manifestB *manifest
 }
 
 func main() {
 	cfg := loadConfig()
+	os.Exit(run(cfg, os.Args[1:]))
+}
+
+func runDiff(cfg config, args []string) int {
+	t, err := parseDiffArgs(cfg, "diff", args)
+	if err != nil {
+		return reportUsageError("diff", err)
+	}
+
+	if t.opts.allCopies {
+		return runNway(cfg, t.pathA, t.opts)
+	}
 
-	pathA, suffix, opts, err := parseArgs(os.Args[1:])
+	c, err := compareTrees(cfg, t)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-		os.Exit(exitUsageErr)
+		return exitDiff
+	}
+	diffs := c.diffs
+	if len(diffs) == 0 {
+		saveBaseline(c)
+		fmt.Println("No differences found.")
+		printExtraReports(c, t.opts)
+		return exitOK
+	}
+
+	actions := planSync(diffs, planOptions{})
+	if t.opts.dryRun {
+		printSyncPlan("Would sync (dry run)", actions)
+	} else if t.opts.sync {
+		applySync(diffs, actions, t.pathA, t.pathB)
+		saveBaseline(c)
+	}
+
+	printDiffs(diffs, t.opts)
+	printExtraReports(c, t.opts)
+
+	if t.opts.review {
+		fmt.Println()
+		if reviewDiffs(diffs, t.pathA, t.pathB, os.Stdin, os.Stdout) > 0 {
+			saveBaseline(c)
+		}
+	}
+	return exitDiff
+}
+
+func printExtraReports(c *comparison, opts options) {
+	if len(c.conflicts) > 0 {
+		fmt.Println()
+		printIgnoreConflicts(os.Stdout, c.conflicts, opts.ignorePol)
+	}
+	if opts.dupes {
+		fmt.Println()
+		printDuplicates(os.Stdout, findDuplicates(c.listA, c.listB))
+	}
+	if opts.hardLinks {
+		fmt.Println()
+		printLinkStructure(os.Stdout, compareLinkStructure(c.listA, c.listB))
+	}
+}
+
+// warnIgnoreConflicts is for commands that do not print the full report.
+func warnIgnoreConflicts(c *comparison, opts options) {
+	if len(c.conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: ignore rules of A and B disagree on %d paths (--ignore-rules %s); run diff to list them\n", len(c.conflicts), opts.ignorePol)
+	}
+}
+
+func runSync(cfg config, args []string) int {
+	t, err := parseDiffArgs(cfg, "sync", args)
+	if err != nil {
+		return reportUsageError("sync", err)
+	}
+	if t.opts.allCopies {
+		return reportUsageError("sync", fmt.Errorf("--all is not supported by sync"))
+	}
+
+	c, err := compareTrees(cfg, t)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitDiff
+	}
+	warnIgnoreConflicts(c, t.opts)
+	diffs := c.diffs
+
+	actions := planSync(diffs, planOptions{full: t.opts.fullSync, delete: t.opts.delete})
+	if t.opts.dryRun {
+		printSyncPlan("Would sync (dry run)", actions)
+		fmt.Printf("Summary: %d actions would be applied\n", len(actions))
+		if len(diffs) > 0 {
+			return exitDiff
+		}
+		return exitOK
 	}
+	applySync(diffs, actions, t.pathA, t.pathB)
+	saveBaseline(c)
 
-	pathB, err := computeMirrorPath(pathA, suffix)
+	var synced, remaining, conflicts int
+	for _, d := range diffs {
+		if d.kind == diffSynced {
+			synced++
+		} else {
+			remaining++
+		}
+		if d.kind == diffChanged && d.side == sideBoth {
+			conflicts++
+		}
+	}
+	fmt.Printf("Summary: %d synced, %d differences remaining", synced, remaining)
+	if conflicts > 0 {
+		fmt.Printf(", %d conflicts", conflicts)
+	}
+	fmt.Println()
+	if remaining > 0 {
+		return exitDiff
+	}
+	return exitOK
+}
+
+func runPlan(cfg config, args []string) int {
+	t, err := parseDiffArgs(cfg, "plan", args)
+	if err != nil {
+		return reportUsageError("plan", err)
+	}
+	if t.opts.allCopies || t.opts.dryRun {
+		return reportUsageError("plan", fmt.Errorf("--all and --dry-run are not supported by plan"))
+	}
+
+	c, err := compareTrees(cfg, t)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-		os.Exit(exitUsageErr)
+		return exitDiff
+	}
+	warnIgnoreConflicts(c, t.opts)
+
+	conflicts := 0
+	for _, d := range c.diffs {
+		if d.kind == diffChanged && d.side == sideBoth {
+			conflicts++
+		}
+	}
+	if conflicts > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %d conflicts (both sides changed) left out of the plan\n", conflicts)
 	}
 
-	if _, err := os.Stat(pathB); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: mirror path does not exist: %s\n", pathB)
-		os.Exit(exitUsageErr)
+	p := newSyncPlan(t.pathA, t.pathB, planSync(c.diffs, planOptions{full: true, delete: t.opts.delete}))
+	if t.opts.jsonOut || !isTTY() {
+		if err := p.writeJSON(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitDiff
+		}
+		return exitOK
 	}
 
-	ignorer := newIgnorer(cfg.AlwaysExclude, pathA)
+	printSyncPlan(fmt.Sprintf("Plan: %s → %s", p.RootA, p.RootB), p.Actions)
+	fmt.Printf("Summary: %d actions\n", len(p.Actions))
+	return exitOK
+}
 
-	listA, err := walkTree(pathA, ignorer, "A", opts)
+func runApply(cfg config, args []string) int {
+	var dryRun bool
+	fs := newFlagSet("apply")
+	fs.BoolVar(&dryRun, "dry-run", false, "print the plan without applying it")
+	positional, err := parseCommandLine(fs, args)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error walking %s: %s\n", pathA, err)
-		os.Exit(exitDiff)
+		return reportUsageError("apply", err)
+	}
+	if len(positional) != 1 {
+		return reportUsageError("apply", fmt.Errorf("expected one plan file"))
 	}
 
-	listB, err := walkTree(pathB, ignorer, "B", opts)
+	p, err := loadSyncPlan(positional[0])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error walking %s: %s\n", pathB, err)
-		os.Exit(exitDiff)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitUsageErr
+	}
+	for _, root := range []string{p.RootA, p.RootB} {
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: plan root is not a directory: %s\n", root)
+			return exitUsageErr
+		}
 	}
 
-	diffs := computeDiff(listA, listB, pathA, pathB, opts)
-	if len(diffs) == 0 {
-		fmt.Println("No differences found.")
-		os.Exit(exitOK)
+	if dryRun {
+		printSyncPlan("Would apply (dry run)", p.Actions)
+		fmt.Printf("Summary: %d actions would be applied\n", len(p.Actions))
+		return exitOK
 	}
 
-	syncDocxNotText(diffs, pathA, pathB)
-	syncModes(diffs, pathA, pathB)
+	if applySync(nil, p.Actions, p.RootA, p.RootB) > 0 {
+		return exitDiff
+	}
+	return exitOK
+}
 
-	printDiffs(diffs, opts)
-	os.Exit(exitDiff)
+func openHashCache(opts *options) {
+	if opts.useHashes && !opts.noCache {
+		opts.hashCache = loadHashCache(hashCachePath())
+	}
 }
 
-func parseArgs(args []string) (pathA string, suffix int, opts options, err error) {
-	suffix = 2
+func closeHashCache(opts options) {
+	if opts.hashCache == nil {
+		return
+	}
+	if err := opts.hashCache.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cannot save hash cache: %v\n", err)
+	}
+}
+
+// loadManifestSide returns nil when path is a live directory.
+func loadManifestSide(path string) (*manifest, error) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return nil, nil
+	}
+	return loadManifest(path)
+}
+
+func compareTrees(cfg config, t diffTarget) (*comparison, error) {
+	if t.manifestA != nil || t.manifestB != nil {
+		return compareWithManifest(cfg, t)
+	}
+
+	ignorer := newSideIgnorer(newIgnorer(cfg.AlwaysExclude, t.pathA, t.opts.filters), newIgnorer(cfg.AlwaysExclude, t.pathB, t.opts.filters), t.opts.ignorePol)
+	openHashCache(&t.opts)
+	defer closeHashCache(t.opts)
+
+	lists, err := walkTrees([]string{t.pathA, t.pathB}, []string{"A", "B"}, ignorer, t.opts)
+	if err != nil {
+		return nil, err
+	}
+	listA, listB := lists[0], lists[1]
+
+	c := &comparison{
+		listA:     listA,
+		listB:     listB,
+		diffs:     computeDiff(listA, listB, t.pathA, t.pathB, t.opts),
+		base:      loadBaseline(t.pathA, t.pathB),
+		conflicts: ignorer.conflictList(),
+	}
+	classifyChanges(c.diffs, c.base)
+	return c, nil
+}
+
+// compareWithManifest diffs when one or both sides are recorded manifests.
+func compareWithManifest(cfg config, t diffTarget) (*comparison, error) {
+	t.opts.skipDocx = true
+	t.opts.manifest = true
+	for _, m := range []*manifest{t.manifestA, t.manifestB} {
+		if m != nil && t.opts.useHashes && !m.Hashes {
+			fmt.Fprintf(os.Stderr, "warning: manifest of %s has no hashes, comparing sizes instead\n", m.Root)
+			t.opts.useHashes = false
+		}
+	}
+
+	var listA, listB []fileEntry
+	if t.manifestA != nil {
+		listA = t.manifestA.fileEntries()
+	}
+	if t.manifestB != nil {
+		listB = t.manifestB.fileEntries()
+	}
 
-	var positional []string
-	for _, arg := range args {
-		if arg == "--use-date" {
-			opts.useDate = true
-		} else if arg == "--hashes" {
-			opts.useHashes = true
-		} else if arg == "--verbose" {
-			opts.verbose = true
+	var roots, labels []string
+	if t.manifestA == nil {
+		roots, labels = append(roots, t.pathA), append(labels, "A")
+	}
+	if t.manifestB == nil {
+		roots, labels = append(roots, t.pathB), append(labels, "B")
+	}
+	if len(roots) > 0 {
+		openHashCache(&t.opts)
+		defer closeHashCache(t.opts)
+		lists, err := walkTrees(roots, labels, newIgnorer(cfg.AlwaysExclude, roots[0], t.opts.filters), t.opts)
+		if err != nil {
+			return nil, err
+		}
+		if t.manifestA == nil {
+			listA = lists[0]
 		} else {
-			positional = append(positional, arg)
+			listB = lists[0]
+		}
+	}
+
+	return &comparison{
+		listA: listA,
+		listB: listB,
+		diffs: computeDiff(listA, listB, t.pathA, t.pathB, t.opts),
+	}, nil
+}
+
+func saveBaseline(c *comparison) {
+	if c.base == nil {
+		return
+	}
+	c.base.update(c.listA, c.diffs)
+	if err := c.base.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cannot save baseline: %v\n", err)
+	}
+}
+
+func addDiffFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.useDate, "use-date", false, "also compare modification times")
+	fs.BoolVar(&opts.useHashes, "hashes", false, "compare SHA-256 content hashes instead of sizes")
+	fs.BoolVar(&opts.verbose, "verbose", false, "show per-part details for changed .docx files")
+	fs.IntVar(&opts.jobs, "jobs", 0, "number of files to hash in parallel with --hashes (default: number of CPUs)")
+	fs.BoolVar(&opts.noCache, "no-cache", false, "rehash every file instead of reusing hashes from the on-disk cache")
+	fs.BoolVar(&opts.content, "content", false, "compare the bytes of same-sized files, reading only the pairs that need it")
+	fs.BoolVar(&opts.noQuick, "no-quick-check", false, "with --content, also read files whose size and mtime both match")
+	fs.BoolVar(&opts.follow, "follow-symlinks", false, "compare what symlinks point to instead of the links themselves")
+	fs.BoolVar(&opts.nameForms, "unicode-names", false, "report names spelled in different Unicode normalization forms in A and B")
+	addFilterFlags(fs, &opts.filters)
+}
+
+func addFilterFlags(fs *flag.FlagSet, rules *filterRules) {
+	fs.Var(patternFlag{patterns: &rules.cli}, "exclude", "skip paths matching this gitignore-style `pattern` (repeatable)")
+	fs.Var(patternFlag{patterns: &rules.cli, include: true}, "include", "keep paths matching this `pattern` even if ignore rules skip them; only a pattern with a slash reaches into an ignored directory (repeatable)")
+	fs.BoolVar(&rules.noGitignore, "no-gitignore", false, "ignore .gitignore files and git's exclude files; .differignore files still apply")
+}
+
+// patternFlag shares one list so the last matching pattern wins.
+type patternFlag struct {
+	patterns *[]ignorePattern
+	include  bool
+}
+
+func (f patternFlag) String() string { return "" }
+
+func (f patternFlag) Set(value string) error {
+	p, ok := parseIgnoreLine(value)
+	if !ok {
+		return fmt.Errorf("not a pattern: %q", value)
+	}
+	p.negated = f.include
+	*f.patterns = append(*f.patterns, p)
+	return nil
+}
+
+func parseDiffArgs(cfg config, name string, args []string) (diffTarget, error) {
+	t := diffTarget{suffix: 2}
+	var against string
+
+	fs := newFlagSet(name)
+	addDiffFlags(fs, &t.opts)
+	fs.StringVar(&against, "against", "", "compare against this `path` (a directory or a snapshot manifest) instead of a numbered mirror")
+	fs.BoolVar(&t.opts.allCopies, "all", false, "compare against every numbered mirror at once")
+	fs.BoolVar(&t.opts.dryRun, "dry-run", false, "print the copies and chmods a sync would make without applying them")
+	fs.StringVar(&t.opts.ignorePol, "ignore-rules", cfg.IgnorePolicy, "whose .gitignore rules decide what is compared: a, b, union (skip what either ignores) or intersection (skip what both ignore)")
+	if name == "sync" || name == "plan" {
+		fs.BoolVar(&t.opts.delete, "delete", false, "delete entries that exist only in B")
+	}
+	switch name {
+	case "sync":
+		fs.BoolVar(&t.opts.fullSync, "full", false, "mirror every difference instead of only non-text .docx changes and modes")
+	case "plan":
+		fs.BoolVar(&t.opts.jsonOut, "json", false, "write the plan as JSON (the default when stdout is not a terminal)")
+	case "diff":
+		fs.BoolVar(&t.opts.sync, "sync", false, "copy non-text .docx changes and file modes from A to B")
+		fs.BoolVar(&t.opts.review, "interactive", false, "step through each difference and choose how to resolve it")
+		fs.BoolVar(&t.opts.review, "i", false, "shorthand for --interactive")
+		fs.BoolVar(&t.opts.dupes, "duplicates", false, "also list files with identical content within and across the trees (implies --hashes)")
+		fs.BoolVar(&t.opts.hardLinks, "hard-links", false, "also report files that are hard-linked together on one side but not the other")
+	}
+
+	positional, err := parseCommandLine(fs, args)
+	if err != nil {
+		return t, err
+	}
+
+	if t.opts.dupes {
+		if t.opts.content || t.opts.allCopies {
+			return t, fmt.Errorf("--duplicates cannot be combined with --content or --all")
 		}
+		t.opts.useHashes = true
+	}
+	if t.opts.content && t.opts.useHashes {
+		return t, fmt.Errorf("--content cannot be combined with --hashes")
+	}
+	if t.opts.noQuick && !t.opts.content {
+		return t, fmt.Errorf("--no-quick-check requires --content")
+	}
+	if t.opts.jobs < 0 {
+		return t, fmt.Errorf("--jobs must not be negative, got %d", t.opts.jobs)
+	}
+	if !validIgnorePolicy(t.opts.ignorePol) {
+		return t, fmt.Errorf("--ignore-rules must be a, b, union or intersection, got %q", t.opts.ignorePol)
+	}
+	if t.opts.review && (t.opts.dryRun || t.opts.allCopies) {
+		return t, fmt.Errorf("--interactive cannot be combined with --dry-run or --all")
+	}
+	if against == "" && isFlagSet(fs, "against") {
+		return t, fmt.Errorf("--against requires a path")
+	}
+	if against != "" && t.opts.allCopies {
+		return t, fmt.Errorf("--all cannot be combined with --against")
+	}
+	ignoreRules := isFlagSet(fs, "ignore-rules")
+	if ignoreRules && t.opts.allCopies {
+		return t, fmt.Errorf("--ignore-rules cannot be combined with --all, which applies A's rules to every mirror")
+	}
+	if against != "" && len(positional) > 1 {
+		return t, fmt.Errorf("a mirror number cannot be combined with --against")
 	}
-	args = positional
+
+	t.pathA, t.suffix, err = parsePathAndSuffix(positional)
+	if err != nil {
+		return t, err
+	}
+	if t.manifestA, err = loadManifestSide(t.pathA); err != nil {
+		return t, err
+	}
+	if t.manifestA != nil && against == "" {
+		return t, fmt.Errorf("a manifest on side A requires --against")
+	}
+
+	switch {
+	case t.opts.allCopies:
+		return t, nil
+	case against != "":
+		t.pathB, err = filepath.Abs(against)
+		if err != nil {
+			return t, fmt.Errorf("cannot resolve path %q: %w", against, err)
+		}
+		if _, statErr := os.Stat(t.pathB); os.IsNotExist(statErr) {
+			return t, fmt.Errorf("path does not exist: %s", t.pathB)
+		}
+	default:
+		t.pathB, err = computeMirrorPath(t.pathA, t.suffix, cfg.Mirrors)
+		if err != nil {
+			return t, err
+		}
+		if _, statErr := os.Stat(t.pathB); os.IsNotExist(statErr) {
+			return t, fmt.Errorf("mirror path does not exist: %s", t.pathB)
+		}
+	}
+
+	if t.pathA == t.pathB {
+		return t, fmt.Errorf("cannot compare %s against itself", t.pathA)
+	}
+	if against != "" {
+		if t.manifestB, err = loadManifestSide(t.pathB); err != nil {
+			return t, err
+		}
+	}
+	if t.manifestA != nil || t.manifestB != nil {
+		if ignoreRules {
+			return t, fmt.Errorf("--ignore-rules cannot be used with a manifest, which has no ignore rules")
+		}
+		if name != "diff" || t.opts.sync || t.opts.review || t.opts.dryRun {
+			return t, fmt.Errorf("a manifest can only be diffed, not synced")
+		}
+		if t.opts.content {
+			return t, fmt.Errorf("--content cannot read file contents from a manifest")
+		}
+	}
+	return t, nil
+}
+
+func parsePathAndSuffix(args []string) (pathA string, suffix int, err error) {
+	suffix = 2
 
 	switch len(args) {
 	case 0:
 		pathA, err = os.Getwd()
 		if err != nil {
-			return "", 0, opts, fmt.Errorf("cannot get working directory: %w", err)
+			return "", 0, fmt.Errorf("cannot get working directory: %w", err)
 		}
 	case 1:
 		pathA, err = filepath.Abs(args[0])
 		if err != nil {
-			return "", 0, opts, fmt.Errorf("cannot resolve path %q: %w", args[0], err)
+			return "", 0, fmt.Errorf("cannot resolve path %q: %w", args[0], err)
 		}
 	case 2:
 		pathA, err = filepath.Abs(args[0])
 		if err != nil {
-			return "", 0, opts, fmt.Errorf("cannot resolve path %q: %w", args[0], err)
+			return "", 0, fmt.Errorf("cannot resolve path %q: %w", args[0], err)
 		}
 		suffix, err = strconv.Atoi(args[1])
 		if err != nil {
-			return "", 0, opts, fmt.Errorf("second argument must be a number, got %q", args[1])
+			return "", 0, fmt.Errorf("second argument must be a number, got %q", args[1])
 		}
 		if suffix < 1 {
-			return "", 0, opts, fmt.Errorf("suffix must be a positive number, got %d", suffix)
+			return "", 0, fmt.Errorf("suffix must be a positive number, got %d", suffix)
 		}
 	default:
-		return "", 0, opts, fmt.Errorf("usage: differ [path] [number]")
+		return "", 0, fmt.Errorf("too many arguments")
 	}
 
 	if _, statErr := os.Stat(pathA); os.IsNotExist(statErr) {
-		return "", 0, opts, fmt.Errorf("path does not exist: %s", pathA)
+		return "", 0, fmt.Errorf("path does not exist: %s", pathA)
 	}
 
-	return pathA, suffix, opts, nil
+	return pathA, suffix, nil
 }
 
-func computeMirrorPath(pathA string, suffix int) (string, error) {
-	home, err := os.UserHomeDir()
+func runMirrors(cfg config, args []string) int {
+	fs := newFlagSet("mirrors")
+	positional, err := parseCommandLine(fs, args)
 	if err != nil {
-		return "", fmt.Errorf("cannot determine home directory: %w", err)
+		return reportUsageError("mirrors", err)
 	}
 
-	if !strings.HasPrefix(pathA, home+string(os.PathSeparator)) {
-		return "", fmt.Errorf("path %q is not under home directory %q", pathA, home)
-	}
-
-	rel := strings.TrimPrefix(pathA, home+string(os.PathSeparator))
-	parts := strings.SplitN(rel, string(os.PathSeparator), 2)
-	component := parts[0]
-	if component == "" {
-		return "", fmt.Errorf("path %q has no directory component after home", pathA)
+	pathA, suffix, err := parsePathAndSuffix(positional)
+	if err != nil {
+		return reportUsageError("mirrors", err)
 	}
-
-	newComponent := fmt.Sprintf("%s.%d", component, suffix)
-	result := filepath.Join(home, newComponent)
-	if len(parts) > 1 {
-		result = filepath.Join(result, parts[1])
+	if !printMirrorResolution(pathA, suffix, cfg.Mirrors) {
+		return exitDiff
 	}
-	return result, nil
+	return exitOK
 }
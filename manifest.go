@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+const manifestVersion = 1
+
+type manifestEntry struct {
+	Path     string      `json:"path"`
+	Size     int64       `json:"size"`
+	Mode     os.FileMode `json:"mode"`
+	ModTime  time.Time   `json:"mtime"`
+	Hash     string      `json:"hash,omitempty"`
+	Target   string      `json:"target,omitempty"`
+	Dangling bool        `json:"dangling,omitempty"`
+	Link     string      `json:"link,omitempty"`
+}
+
+type manifest struct {
+	Version int             `json:"version"`
+	Root    string          `json:"root"`
+	Created time.Time       `json:"created"`
+	Hashes  bool            `json:"hashes"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+// manifestInfo presents a recorded entry as an os.FileInfo.
+type manifestInfo struct {
+	m *manifestEntry
+}
+
+func (i manifestInfo) Name() string       { return path.Base(i.m.Path) }
+func (i manifestInfo) Size() int64        { return i.m.Size }
+func (i manifestInfo) Mode() os.FileMode  { return i.m.Mode }
+func (i manifestInfo) ModTime() time.Time { return i.m.ModTime }
+func (i manifestInfo) IsDir() bool        { return i.m.Mode.IsDir() }
+func (i manifestInfo) Sys() interface{}   { return nil }
+
+func toManifestEntry(e *fileEntry) manifestEntry {
+	return manifestEntry{
+		Path:     e.relPath,
+		Size:     e.info.Size(),
+		Mode:     e.info.Mode(),
+		ModTime:  e.info.ModTime(),
+		Hash:     e.hash,
+		Target:   e.target,
+		Dangling: e.dangling,
+		Link:     e.linkID,
+	}
+}
+
+func newManifest(root string, entries []fileEntry, hashes bool) *manifest {
+	m := &manifest{
+		Version: manifestVersion,
+		Root:    root,
+		Created: time.Now(),
+		Hashes:  hashes,
+		Entries: make([]manifestEntry, len(entries)),
+	}
+	for i := range entries {
+		m.Entries[i] = toManifestEntry(&entries[i])
+	}
+	return m
+}
+
+func (m *manifest) writeJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func (m *manifest) fileEntries() []fileEntry {
+	entries := make([]fileEntry, len(m.Entries))
+	for i := range m.Entries {
+		entries[i] = fileEntry{
+			relPath:  m.Entries[i].Path,
+			info:     manifestInfo{&m.Entries[i]},
+			hash:     m.Entries[i].Hash,
+			target:   m.Entries[i].Target,
+			dangling: m.Entries[i].Dangling,
+			linkID:   m.Entries[i].Link,
+		}
+	}
+	return entries
+}
+
+func loadManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest %s: %w", path, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("manifest %s has unsupported version %d", path, m.Version)
+	}
+	for i := 1; i < len(m.Entries); i++ {
+		if m.Entries[i-1].Path >= m.Entries[i].Path {
+			return nil, fmt.Errorf("manifest %s: entries are not sorted at %q", path, m.Entries[i].Path)
+		}
+	}
+	return &m, nil
+}
+
+func runSnapshot(cfg config, args []string) int {
+	var opts options
+	var output string
+	fs := newFlagSet("snapshot")
+	fs.BoolVar(&opts.useHashes, "hashes", false, "record SHA-256 content hashes")
+	fs.IntVar(&opts.jobs, "jobs", 0, "number of files to hash in parallel with --hashes (default: number of CPUs)")
+	fs.BoolVar(&opts.noCache, "no-cache", false, "rehash every file instead of reusing hashes from the on-disk cache")
+	fs.BoolVar(&opts.follow, "follow-symlinks", false, "record what symlinks point to instead of the links themselves")
+	addFilterFlags(fs, &opts.filters)
+	fs.StringVar(&output, "o", "", "write the manifest to this `file` instead of stdout")
+	fs.StringVar(&output, "output", "", "same as -o")
+	positional, err := parseCommandLine(fs, args)
+	if err != nil {
+		return reportUsageError("snapshot", err)
+	}
+	if opts.jobs < 0 {
+		return reportUsageError("snapshot", fmt.Errorf("--jobs must not be negative, got %d", opts.jobs))
+	}
+	if len(positional) > 1 {
+		return reportUsageError("snapshot", fmt.Errorf("too many arguments"))
+	}
+
+	root, _, err := parsePathAndSuffix(positional)
+	if err != nil {
+		return reportUsageError("snapshot", err)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return reportUsageError("snapshot", fmt.Errorf("not a directory: %s", root))
+	}
+
+	openHashCache(&opts)
+	lists, err := walkTrees([]string{root}, []string{"snapshot"}, newIgnorer(cfg.AlwaysExclude, root, opts.filters), opts)
+	closeHashCache(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitDiff
+	}
+	m := newManifest(root, lists[0], opts.useHashes)
+
+	if output == "" {
+		if err := m.writeJSON(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitDiff
+		}
+		return exitOK
+	}
+
+	tmp := output + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitDiff
+	}
+	err = m.writeJSON(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, output)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitDiff
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d entries from %s to %s\n", len(m.Entries), root, output)
+	return exitOK
+}
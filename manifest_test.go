@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	mod := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	entries := []fileEntry{
+		{relPath: "docs", info: fakeInfo{name: "docs", mode: os.ModeDir | 0755, dir: true, mod: mod}},
+		{relPath: "docs/a.txt", info: fakeInfo{name: "a.txt", size: 12, mode: 0644, mod: mod}, hash: "abc"},
+	}
+	m := newManifest("/src", entries, true)
+
+	var buf bytes.Buffer
+	if err := m.writeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "m.json")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Root != "/src" || !loaded.Hashes {
+		t.Errorf("header = (%q, %v), want (/src, true)", loaded.Root, loaded.Hashes)
+	}
+	got := loaded.fileEntries()
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got))
+	}
+	if !got[0].info.IsDir() || got[0].info.Name() != "docs" {
+		t.Errorf("entry 0 = %q dir=%v, want docs dir", got[0].info.Name(), got[0].info.IsDir())
+	}
+	f := got[1]
+	if f.relPath != "docs/a.txt" || f.info.Size() != 12 || f.info.Mode() != 0644 || f.hash != "abc" || !f.info.ModTime().Equal(mod) {
+		t.Errorf("entry 1 = %+v, want docs/a.txt 12 0644 abc %v", f, mod)
+	}
+}
+
+func TestLoadManifestRejectsBadInput(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"corrupt":  `{`,
+		"version":  `{"version": 9, "entries": []}`,
+		"unsorted": `{"version": 1, "entries": [{"path": "b"}, {"path": "a"}]}`,
+	}
+	for name, body := range tests {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadManifest(path); err == nil {
+			t.Errorf("%s: loadManifest succeeded, want error", name)
+		}
+	}
+}
+
+func TestDiffAgainstManifest(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{"same.txt": "hello", "grown.txt": "hello world", "new.txt": "x"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap := &manifest{Version: manifestVersion, Root: "/backup", Entries: []manifestEntry{
+		{Path: "gone.txt", Size: 3, Mode: 0644},
+		{Path: "grown.txt", Size: 5, Mode: 0644},
+		{Path: "same.txt", Size: 5, Mode: 0644},
+	}}
+	path := filepath.Join(t.TempDir(), "snap.json")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.writeJSON(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	target := diffTarget{pathA: root, pathB: path, opts: options{quiet: true}}
+	if target.manifestB, err = loadManifestSide(path); err != nil || target.manifestB == nil {
+		t.Fatalf("loadManifestSide = %v, %v; want a manifest", target.manifestB, err)
+	}
+	c, err := compareTrees(config{}, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]diffKind{}
+	for _, d := range c.diffs {
+		got[d.relPath] = d.kind
+	}
+	want := map[string]diffKind{"grown.txt": diffChanged, "new.txt": diffOnlyA, "gone.txt": diffOnlyB}
+	if len(got) != len(want) {
+		t.Fatalf("diffs = %v, want %v", got, want)
+	}
+	for p, k := range want {
+		if got[p] != k {
+			t.Errorf("%s: kind = %d, want %d", p, got[p], k)
+		}
+	}
+	if c.base != nil {
+		t.Error("manifest comparison loaded a baseline")
+	}
+}
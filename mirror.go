@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultMirrorTemplate = "{home}/{component}.{n}/{rest}"
+
+var (
+	placeholderRe = regexp.MustCompile(`\{[a-z]+\}`)
+	placeholders  = map[string]bool{
+		"{home}": true, "{path}": true, "{rel}": true,
+		"{component}": true, "{rest}": true, "{n}": true,
+	}
+)
+
+type mirrorRule struct {
+	Template string `json:"template,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+	Replace  string `json:"replace,omitempty"`
+}
+
+func (r mirrorRule) String() string {
+	if r.Regex != "" {
+		return fmt.Sprintf("regex %s → %s", r.Regex, r.Replace)
+	}
+	return "template " + r.Template
+}
+
+type mirrorResolution struct {
+	rule   mirrorRule
+	path   string
+	exists bool
+	err    error
+}
+
+type homeParts struct {
+	home      string
+	rel       string
+	component string
+	rest      string
+}
+
+func splitHome(pathA string) (homeParts, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return homeParts{}, fmt.Errorf("cannot determine home directory: %w", err)
+	}
+
+	if !strings.HasPrefix(pathA, home+string(os.PathSeparator)) {
+		return homeParts{home: home}, fmt.Errorf("path %q is not under home directory %q", pathA, home)
+	}
+
+	rel := strings.TrimPrefix(pathA, home+string(os.PathSeparator))
+	parts := strings.SplitN(rel, string(os.PathSeparator), 2)
+	hp := homeParts{home: home, rel: rel, component: parts[0]}
+	if hp.component == "" {
+		return hp, fmt.Errorf("path %q has no directory component after home", pathA)
+	}
+	if len(parts) > 1 {
+		hp.rest = parts[1]
+	}
+	return hp, nil
+}
+
+func expandMirrorTemplate(tmpl, pathA, n string) (string, error) {
+	for _, ph := range placeholderRe.FindAllString(tmpl, -1) {
+		if !placeholders[ph] {
+			return "", fmt.Errorf("unknown placeholder %s in template %q", ph, tmpl)
+		}
+	}
+
+	needsHome := strings.Contains(tmpl, "{rel}") ||
+		strings.Contains(tmpl, "{component}") ||
+		strings.Contains(tmpl, "{rest}")
+
+	hp, err := splitHome(pathA)
+	if err != nil && (needsHome || (hp.home == "" && strings.Contains(tmpl, "{home}"))) {
+		return "", err
+	}
+
+	out := strings.NewReplacer(
+		"{home}", hp.home,
+		"{path}", pathA,
+		"{rel}", hp.rel,
+		"{component}", hp.component,
+		"{rest}", hp.rest,
+		"{n}", n,
+	).Replace(tmpl)
+
+	if !filepath.IsAbs(out) {
+		return "", fmt.Errorf("template %q does not produce an absolute path", tmpl)
+	}
+	return filepath.Clean(out), nil
+}
+
+func applyMirrorRule(r mirrorRule, pathA string, suffix int) (string, error) {
+	return expandMirrorRule(r, pathA, strconv.Itoa(suffix))
+}
+
+func expandMirrorRule(r mirrorRule, pathA, n string) (string, error) {
+	switch {
+	case r.Regex != "":
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return "", fmt.Errorf("invalid regex %q: %w", r.Regex, err)
+		}
+		m := re.FindStringSubmatchIndex(pathA)
+		if m == nil {
+			return "", fmt.Errorf("regex %q does not match %q", r.Regex, pathA)
+		}
+		replaced := string(re.ExpandString(nil, r.Replace, pathA, m))
+		return expandMirrorTemplate(replaced, pathA, n)
+	case r.Template != "":
+		return expandMirrorTemplate(r.Template, pathA, n)
+	default:
+		return "", fmt.Errorf("rule has neither a template nor a regex")
+	}
+}
+
+func resolveMirrors(pathA string, suffix int, rules []mirrorRule) []mirrorResolution {
+	var results []mirrorResolution
+	for _, r := range rules {
+		res := mirrorResolution{rule: r}
+		res.path, res.err = applyMirrorRule(r, pathA, suffix)
+		if res.err == nil && res.path == pathA {
+			res.err = fmt.Errorf("rule maps %q onto itself", pathA)
+		}
+		if res.err == nil {
+			if _, err := os.Stat(res.path); err == nil {
+				res.exists = true
+			}
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func selectMirror(results []mirrorResolution) int {
+	first := -1
+	for i, res := range results {
+		if res.err != nil {
+			continue
+		}
+		if res.exists {
+			return i
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	return first
+}
+
+func computeMirrorPath(pathA string, suffix int, rules []mirrorRule) (string, error) {
+	if len(rules) == 0 {
+		rules = []mirrorRule{{Template: defaultMirrorTemplate}}
+	}
+
+	results := resolveMirrors(pathA, suffix, rules)
+	idx := selectMirror(results)
+	if idx < 0 {
+		return "", results[0].err
+	}
+	return results[idx].path, nil
+}
+
+// suffixMarker stands in for {n}; it cannot occur in a real path.
+const suffixMarker = "\x00"
+
+// suffixCandidates matches the directory names beside r's {n} component.
+func suffixCandidates(r mirrorRule, pathA string) []int {
+	p, err := expandMirrorRule(r, pathA, suffixMarker)
+	if err != nil {
+		return nil
+	}
+	i := strings.Index(p, suffixMarker)
+	if i < 0 {
+		return nil
+	}
+	start := strings.LastIndex(p[:i], string(os.PathSeparator)) + 1
+	end := len(p)
+	if j := strings.IndexRune(p[i:], os.PathSeparator); j >= 0 {
+		end = i + j
+	}
+	before, after := p[start:i], p[i+len(suffixMarker):end]
+	if strings.Contains(after, suffixMarker) {
+		return nil
+	}
+
+	dirEntries, err := os.ReadDir(filepath.Dir(p[:end]))
+	if err != nil {
+		return nil
+	}
+	var suffixes []int
+	for _, de := range dirEntries {
+		name := de.Name()
+		if len(name) <= len(before)+len(after) || !strings.HasPrefix(name, before) || !strings.HasSuffix(name, after) {
+			continue
+		}
+		n, err := strconv.Atoi(name[len(before) : len(name)-len(after)])
+		if err != nil || n < 1 {
+			continue
+		}
+		suffixes = append(suffixes, n)
+	}
+	return suffixes
+}
+
+func discoverSuffixes(pathA string, rules []mirrorRule) []int {
+	if len(rules) == 0 {
+		rules = []mirrorRule{{Template: defaultMirrorTemplate}}
+	}
+
+	seen := make(map[int]bool)
+	var suffixes []int
+	for _, r := range rules {
+		for _, n := range suffixCandidates(r, pathA) {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			pathB, err := computeMirrorPath(pathA, n, rules)
+			if err != nil {
+				continue
+			}
+			if info, err := os.Stat(pathB); err != nil || !info.IsDir() {
+				continue
+			}
+			suffixes = append(suffixes, n)
+		}
+	}
+	sort.Ints(suffixes)
+	return suffixes
+}
+
+func printMirrorResolution(pathA string, suffix int, rules []mirrorRule) bool {
+	results := resolveMirrors(pathA, suffix, rules)
+	selected := selectMirror(results)
+
+	fmt.Printf("Mirror rules for %s (n=%d):\n", pathA, suffix)
+	for i, res := range results {
+		fmt.Printf("  %d. %s\n", i+1, res.rule)
+		switch {
+		case res.err != nil:
+			fmt.Printf("       skipped: %s\n", res.err)
+		case i == selected && res.exists:
+			fmt.Printf("       → %s (exists, selected)\n", res.path)
+		case i == selected:
+			fmt.Printf("       → %s (does not exist, selected: no rule resolved to an existing path)\n", res.path)
+		case res.exists:
+			fmt.Printf("       → %s (exists, earlier rule wins)\n", res.path)
+		default:
+			fmt.Printf("       → %s (does not exist)\n", res.path)
+		}
+	}
+	if selected < 0 {
+		fmt.Println("No rule resolved a mirror path.")
+		return false
+	}
+	return true
+}
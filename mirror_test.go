@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyMirrorRule(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	tests := []struct {
+		name    string
+		rule    mirrorRule
+		pathA   string
+		suffix  int
+		want    string
+		wantErr bool
+	}{
+		{"default top level", mirrorRule{Template: defaultMirrorTemplate}, home + "/work", 2, home + "/work.2", false},
+		{"default nested", mirrorRule{Template: defaultMirrorTemplate}, home + "/work/a/b", 3, home + "/work.3/a/b", false},
+		{"default outside home", mirrorRule{Template: defaultMirrorTemplate}, "/srv/data", 2, "", true},
+		{"rel template", mirrorRule{Template: "/mnt/backup/{rel}"}, home + "/work/a", 2, "/mnt/backup/work/a", false},
+		{"path template outside home", mirrorRule{Template: "/backup{path}"}, "/srv/data", 2, "/backup/srv/data", false},
+		{"unknown placeholder", mirrorRule{Template: "/x/{bogus}"}, home + "/work", 2, "", true},
+		{"relative result", mirrorRule{Template: "{component}.{n}"}, home + "/work", 2, "", true},
+		{"regex rewrite", mirrorRule{Regex: `^/srv/(.*)$`, Replace: "/backup/$1"}, "/srv/data/x", 2, "/backup/data/x", false},
+		{"regex with suffix", mirrorRule{Regex: `^/srv/(.*)$`, Replace: "/backup.{n}/$1"}, "/srv/data", 4, "/backup.4/data", false},
+		{"regex no match", mirrorRule{Regex: `^/srv/(.*)$`, Replace: "/backup/$1"}, "/opt/data", 2, "", true},
+		{"invalid regex", mirrorRule{Regex: `(`, Replace: "/x"}, "/opt/data", 2, "", true},
+		{"empty rule", mirrorRule{}, home + "/work", 2, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyMirrorRule(tt.rule, tt.pathA, tt.suffix)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyMirrorRule(%+v, %q) error = %v, wantErr %v", tt.rule, tt.pathA, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("applyMirrorRule(%+v, %q) = %q, want %q", tt.rule, tt.pathA, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeMirrorPath_PrefersExisting(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	existing := filepath.Join(home, "alt", "work")
+	if err := os.MkdirAll(existing, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []mirrorRule{
+		{Template: defaultMirrorTemplate},
+		{Template: "{home}/alt/{rel}"},
+	}
+	got, err := computeMirrorPath(filepath.Join(home, "work"), 2, rules)
+	if err != nil {
+		t.Fatalf("computeMirrorPath returned error: %v", err)
+	}
+	if got != existing {
+		t.Errorf("computeMirrorPath = %q, want %q", got, existing)
+	}
+}
+
+func TestComputeMirrorPath_FallsBackToFirstResolved(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	got, err := computeMirrorPath(filepath.Join(home, "work"), 2, nil)
+	if err != nil {
+		t.Fatalf("computeMirrorPath returned error: %v", err)
+	}
+	if want := filepath.Join(home, "work.2"); got != want {
+		t.Errorf("computeMirrorPath = %q, want %q", got, want)
+	}
+}
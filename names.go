@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// nameForm names the Unicode normalization form a path is spelled in.
+func nameForm(s string) string {
+	switch {
+	case norm.NFC.IsNormalString(s):
+		return "NFC"
+	case norm.NFD.IsNormalString(s):
+		return "NFD"
+	default:
+		return "mixed"
+	}
+}
+
+// resolveCollisions keeps names that clash once normalized apart and warns.
+func resolveCollisions(entries []fileEntry) []string {
+	var warnings []string
+
+	byNFC := make(map[string][]int)
+	for i := range entries {
+		byNFC[entries[i].relPath] = append(byNFC[entries[i].relPath], i)
+	}
+	for key, group := range byNFC {
+		if len(group) < 2 {
+			continue
+		}
+		var names []string
+		for _, i := range group {
+			names = append(names, fmt.Sprintf("%s (%s)", entries[i].rawPath, nameForm(entries[i].rawPath)))
+			if entries[i].rawPath != key {
+				entries[i].relPath = entries[i].rawPath
+			}
+		}
+		if sameRawParent(entries, group) {
+			sort.Strings(names)
+			warnings = append(warnings, fmt.Sprintf("names collide after Unicode normalization: %s", strings.Join(names, ", ")))
+		}
+	}
+
+	fold := cases.Fold()
+	byFold := make(map[string][]int)
+	for i := range entries {
+		key := fold.String(entries[i].relPath)
+		byFold[key] = append(byFold[key], i)
+	}
+	for _, group := range byFold {
+		if len(group) < 2 || !sameRawParent(entries, group) {
+			continue
+		}
+		var names []string
+		for _, i := range group {
+			names = append(names, entries[i].relPath)
+		}
+		sort.Strings(names)
+		warnings = append(warnings, fmt.Sprintf("names collide on case-insensitive filesystems: %s", strings.Join(names, ", ")))
+	}
+
+	sort.Strings(warnings)
+	return warnings
+}
+
+// onDiskPath joins rel onto root in the spelling existing names have on disk.
+func onDiskPath(root, rel string) string {
+	cur := root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		next := filepath.Join(cur, name)
+		if _, err := os.Lstat(next); err != nil {
+			if dirEntries, err := os.ReadDir(cur); err == nil {
+				want := norm.NFC.String(name)
+				for _, de := range dirEntries {
+					if norm.NFC.String(de.Name()) == want {
+						next = filepath.Join(cur, de.Name())
+						break
+					}
+				}
+			}
+		}
+		cur = next
+	}
+	return cur
+}
+
+func sameRawParent(entries []fileEntry, group []int) bool {
+	parent := filepath.Dir(entries[group[0]].rawPath)
+	for _, i := range group[1:] {
+		if filepath.Dir(entries[i].rawPath) != parent {
+			return false
+		}
+	}
+	return true
+}
+
+// nameFormDetail reports a path spelled in different normalization forms.
+func nameFormDetail(a, b *fileEntry) string {
+	if a.relPath != b.relPath || a.rawPath == "" || b.rawPath == "" || a.rawPath == b.rawPath {
+		return ""
+	}
+	return fmt.Sprintf("name: %s vs %s", nameForm(a.rawPath), nameForm(b.rawPath))
+}
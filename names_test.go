@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestResolveCollisions(t *testing.T) {
+	nfc := norm.NFC.String("café")
+	nfd := norm.NFD.String("café")
+	entry := func(raw string) fileEntry {
+		return fileEntry{relPath: norm.NFC.String(raw), rawPath: raw, info: fakeInfo{mode: 0644}}
+	}
+	entries := []fileEntry{
+		entry(nfc),
+		entry(nfd),
+		entry("README"),
+		entry("readme"),
+		entry(filepath.Join(nfc, "x")),
+		entry(filepath.Join(nfd, "x")),
+	}
+
+	warnings := resolveCollisions(entries)
+
+	if len(warnings) != 2 {
+		t.Fatalf("warnings = %q, want one normalization and one case warning", warnings)
+	}
+	if !strings.Contains(warnings[0], "Unicode normalization") || !strings.Contains(warnings[0], "(NFD)") {
+		t.Errorf("warnings[0] = %q, want the café normalization clash", warnings[0])
+	}
+	if !strings.Contains(warnings[1], "case-insensitive") || !strings.Contains(warnings[1], "README, readme") {
+		t.Errorf("warnings[1] = %q, want the README/readme case clash", warnings[1])
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if seen[e.relPath] {
+			t.Errorf("relPath %q is still shared after resolving collisions", e.relPath)
+		}
+		seen[e.relPath] = true
+	}
+	if entries[0].relPath != nfc || entries[1].relPath != nfd {
+		t.Errorf("relPaths = %q, %q; want the NFC name kept and the NFD one spelled as on disk", entries[0].relPath, entries[1].relPath)
+	}
+}
+
+func TestWalkTree_NormalizationCollision(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{norm.NFC.String("café"), norm.NFD.String("café")} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := walkTree(root, newIgnorer(nil, root, filterRules{}), "A", options{}, newProgress(true, "A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Skipf("filesystem normalizes names itself: got %d entries", len(entries))
+	}
+	if entries[0].relPath == entries[1].relPath {
+		t.Errorf("both files share relPath %q", entries[0].relPath)
+	}
+}
+
+func TestCompareEntries_UnicodeNames(t *testing.T) {
+	a := &fileEntry{relPath: norm.NFC.String("café"), rawPath: norm.NFC.String("café"), info: fakeInfo{size: 1, mode: 0644}}
+	b := &fileEntry{relPath: norm.NFC.String("café"), rawPath: norm.NFD.String("café"), info: fakeInfo{size: 1, mode: 0644}}
+
+	if changes, _ := compareEntries(a, b, "/tmp/a", "/tmp/b", options{}); len(changes) != 0 {
+		t.Errorf("changes without --unicode-names = %v, want none", changes)
+	}
+	changes, _ := compareEntries(a, b, "/tmp/a", "/tmp/b", options{nameForms: true})
+	if len(changes) != 1 || changes[0] != "name: NFC vs NFD" {
+		t.Errorf("changes = %v, want [name: NFC vs NFD]", changes)
+	}
+	if actions := planSync([]diffEntry{{kind: diffChanged, relPath: a.relPath, entryA: a, entryB: b, details: changes}}, planOptions{full: true}); len(actions) != 0 {
+		t.Errorf("planSync copied a name-only difference: %+v", actions)
+	}
+}
+
+func TestContentAndSync_UnicodeNames(t *testing.T) {
+	rootA, rootB := t.TempDir(), t.TempDir()
+	nfc, nfd := norm.NFC.String("café"), norm.NFD.String("café")
+	writeTestFile(t, filepath.Join(rootA, nfc, "menu.txt"), "same")
+	writeTestFile(t, filepath.Join(rootB, nfd, "menu.txt"), "same")
+	if _, err := os.Stat(filepath.Join(rootB, nfc)); err == nil {
+		t.Skip("filesystem normalizes names itself")
+	}
+
+	opts := options{quiet: true, content: true, noQuick: true}
+	lists, err := walkTrees([]string{rootA, rootB}, []string{"A", "B"}, newIgnorer(nil, rootA, filterRules{}), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := computeDiff(lists[0], lists[1], rootA, rootB, opts); len(diffs) != 0 {
+		t.Errorf("diffs = %+v, want none for identical content", diffs)
+	}
+
+	writeTestFile(t, filepath.Join(rootA, nfc, "menu.txt"), "new!")
+	t.Setenv("HOME", t.TempDir())
+	x := &syncExecutor{rootA: rootA, rootB: rootB}
+	if err := x.apply(syncAction{Op: opCopy, Path: filepath.Join(nfc, "menu.txt")}); err != nil {
+		t.Fatal(err)
+	}
+	names, err := os.ReadDir(rootB)
+	if err != nil || len(names) != 1 || names[0].Name() != nfd {
+		t.Fatalf("B holds %v (err %v), want only the NFD directory", names, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(rootB, nfd, "menu.txt")); string(data) != "new!" {
+		t.Errorf("B's menu.txt = %q, want the copied content", data)
+	}
+}
+
+func TestWalkTree_IgnoreFileInNFDDirectory(t *testing.T) {
+	root := t.TempDir()
+	nfd := norm.NFD.String("café")
+	writeTestFile(t, filepath.Join(root, nfd, ".gitignore"), "*.tmp\n")
+	writeTestFile(t, filepath.Join(root, nfd, "scratch.tmp"), "x")
+	writeTestFile(t, filepath.Join(root, nfd, "menu.txt"), "x")
+
+	entries, err := walkTree(root, newIgnorer(nil, root, filterRules{}), "A", options{}, newProgress(true, "A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.relPath, "scratch.tmp") {
+			t.Errorf("%s was walked despite the .gitignore in its directory", e.relPath)
+		}
+	}
+	if len(entries) != 3 {
+		t.Errorf("walked %d entries, want the directory, its .gitignore and menu.txt", len(entries))
+	}
+}
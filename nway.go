@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const nwayColWidth = 5
+
+type copyState int
+
+const (
+	copyMissing copyState = iota
+	copyIdentical
+	copyChanged
+	copyPresent
+)
+
+type nwayCopy struct {
+	label   string
+	root    string
+	entries map[string]*fileEntry
+}
+
+type nwayRow struct {
+	relPath string
+	states  []copyState
+	newest  []bool
+	details [][]string
+}
+
+func runNway(cfg config, pathA string, opts options) int {
+	var roots []string
+	var labels []string
+	for _, n := range discoverSuffixes(pathA, cfg.Mirrors) {
+		pathB, err := computeMirrorPath(pathA, n, cfg.Mirrors)
+		if err != nil {
+			continue
+		}
+		roots = append(roots, pathB)
+		labels = append(labels, fmt.Sprintf(".%d", n))
+	}
+	if len(roots) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no numbered mirrors found for %s\n", pathA)
+		return exitUsageErr
+	}
+
+	ignorer := newIgnorer(cfg.AlwaysExclude, pathA, opts.filters)
+	openHashCache(&opts)
+	defer closeHashCache(opts)
+
+	lists, err := walkTrees(append([]string{pathA}, roots...), append([]string{"A"}, labels...), ignorer, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitDiff
+	}
+
+	var copies []nwayCopy
+	for i, root := range roots {
+		copies = append(copies, nwayCopy{label: labels[i], root: root, entries: entryMap(lists[i+1])})
+	}
+
+	rows := computeNway(lists[0], pathA, copies, opts)
+	if len(rows) == 0 {
+		fmt.Println("No differences found.")
+		return exitOK
+	}
+
+	printNway(rows, pathA, copies, opts)
+	return exitDiff
+}
+
+func entryMap(list []fileEntry) map[string]*fileEntry {
+	m := make(map[string]*fileEntry, len(list))
+	for i := range list {
+		m[list[i].relPath] = &list[i]
+	}
+	return m
+}
+
+func computeNway(listA []fileEntry, rootA string, copies []nwayCopy, opts options) []nwayRow {
+	mapA := entryMap(listA)
+
+	pathSet := make(map[string]bool, len(listA))
+	for _, e := range listA {
+		pathSet[e.relPath] = true
+	}
+	for _, c := range copies {
+		for p := range c.entries {
+			pathSet[p] = true
+		}
+	}
+	paths := make([]string, 0, len(pathSet))
+	for p := range pathSet {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var rows []nwayRow
+	for _, p := range paths {
+		a := mapA[p]
+		row := nwayRow{
+			relPath: p,
+			states:  make([]copyState, len(copies)+1),
+			newest:  make([]bool, len(copies)+1),
+			details: make([][]string, len(copies)+1),
+		}
+		present := []*fileEntry{a}
+		differs := a == nil
+		if a != nil {
+			row.states[0] = copyPresent
+		}
+
+		for i, c := range copies {
+			b := c.entries[p]
+			present = append(present, b)
+			switch {
+			case b == nil:
+				row.states[i+1] = copyMissing
+				differs = true
+			case a == nil:
+				row.states[i+1] = copyPresent
+			default:
+				changes, _ := compareEntries(a, b, rootA, c.root, opts)
+				if len(changes) > 0 {
+					row.states[i+1] = copyChanged
+					row.details[i+1] = changes
+					differs = true
+				} else {
+					row.states[i+1] = copyIdentical
+				}
+			}
+		}
+		if !differs {
+			continue
+		}
+
+		markNewest(row.newest, present)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func markNewest(newest []bool, present []*fileEntry) {
+	var latest *fileEntry
+	for _, e := range present {
+		if e == nil || e.info.IsDir() {
+			continue
+		}
+		if latest == nil || e.info.ModTime().After(latest.info.ModTime()) {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return
+	}
+	for i, e := range present {
+		if e != nil && !e.info.IsDir() && e.info.ModTime().Equal(latest.info.ModTime()) {
+			newest[i] = true
+		}
+	}
+}
+
+func copyStateSymbol(s copyState) string {
+	switch s {
+	case copyIdentical:
+		return "="
+	case copyChanged:
+		return "~"
+	case copyPresent:
+		return "+"
+	default:
+		return "-"
+	}
+}
+
+func printNway(rows []nwayRow, rootA string, copies []nwayCopy, opts options) {
+	w := termWidth()
+	fileMax := w - 2 - (len(copies)+1)*(nwayColWidth+1)
+	if fileMax < minFileCol {
+		fileMax = minFileCol
+	}
+
+	fmt.Println(colorCyan(fmt.Sprintf("=== N-way: A = %s ===", rootA)))
+	for _, c := range copies {
+		fmt.Println(colorCyan(fmt.Sprintf("  %-*s %s", nwayColWidth, c.label, c.root)))
+	}
+	fmt.Println(colorCyan("  legend: + present  = identical to A  ~ changed  - missing  * most recently modified"))
+	fmt.Println()
+
+	header := fmt.Sprintf("  %-*s", nwayColWidth, "A")
+	for _, c := range copies {
+		header += fmt.Sprintf(" %-*s", nwayColWidth, c.label)
+	}
+	header += " FILE"
+	fmt.Println(colorCyan(header))
+	fmt.Println(colorCyan(strings.Repeat("-", w)))
+
+	for _, row := range rows {
+		line := " "
+		for i, s := range row.states {
+			cell := copyStateSymbol(s)
+			if row.newest[i] {
+				cell += "*"
+			}
+			line += fmt.Sprintf(" %-*s", nwayColWidth, cell)
+		}
+		fmt.Println(line + " " + truncatePath(row.relPath, fileMax))
+
+		if opts.verbose {
+			for i, details := range row.details {
+				if len(details) == 0 {
+					continue
+				}
+				fmt.Println(colorYellow(fmt.Sprintf("      %s: %s", copies[i-1].label, strings.Join(details, ", "))))
+			}
+		}
+	}
+	fmt.Println()
+
+	fmt.Printf("Summary: %d paths differ across %d copies\n", len(rows), len(copies))
+}
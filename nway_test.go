@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiscoverSuffixes(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, name := range []string{"work", "work.2", "work.10", "work.3", "work.x", "work.0", "other.2", "snap.5/work", "snap.6"} {
+		if err := os.MkdirAll(filepath.Join(home, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(home, "work.4"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		rules []mirrorRule
+		want  []int
+	}{
+		{"default rule", nil, []int{2, 3, 10}},
+		{"template", []mirrorRule{{Template: "{home}/snap.{n}/{rel}"}}, []int{5}},
+		{"regex", []mirrorRule{{Regex: `^(.*)/work$`, Replace: "$1/snap.{n}/work"}}, []int{5}},
+		{"rules combined", []mirrorRule{{Template: defaultMirrorTemplate}, {Template: "{home}/snap.{n}/{rel}"}}, []int{2, 3, 5, 10}},
+		{"no suffix placeholder", []mirrorRule{{Template: "{home}/other.2"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := discoverSuffixes(filepath.Join(home, "work"), tt.rules)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("discoverSuffixes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeNway(t *testing.T) {
+	older := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	listA := []fileEntry{
+		{relPath: "same.txt", info: fakeInfo{name: "same.txt", size: 10, mod: older}},
+		{relPath: "edited.txt", info: fakeInfo{name: "edited.txt", size: 10, mod: older}},
+	}
+	copies := []nwayCopy{
+		{label: ".2", entries: entryMap([]fileEntry{
+			{relPath: "same.txt", info: fakeInfo{name: "same.txt", size: 10, mod: older}},
+			{relPath: "edited.txt", info: fakeInfo{name: "edited.txt", size: 12, mod: newer}},
+		})},
+		{label: ".3", entries: entryMap([]fileEntry{
+			{relPath: "same.txt", info: fakeInfo{name: "same.txt", size: 10, mod: older}},
+			{relPath: "extra.txt", info: fakeInfo{name: "extra.txt", size: 1, mod: older}},
+		})},
+	}
+
+	rows := computeNway(listA, "/tmp/a", copies, options{})
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+
+	edited := rows[0]
+	if edited.relPath != "edited.txt" {
+		t.Fatalf("rows[0].relPath = %q, want %q", edited.relPath, "edited.txt")
+	}
+	wantStates := []copyState{copyPresent, copyChanged, copyMissing}
+	for i, s := range wantStates {
+		if edited.states[i] != s {
+			t.Errorf("edited.states[%d] = %d, want %d", i, edited.states[i], s)
+		}
+	}
+	if edited.newest[0] || !edited.newest[1] {
+		t.Errorf("edited.newest = %v, want only .2 marked", edited.newest)
+	}
+
+	extra := rows[1]
+	if extra.states[0] != copyMissing || extra.states[1] != copyMissing || extra.states[2] != copyPresent {
+		t.Errorf("extra.states = %v, want [missing missing present]", extra.states)
+	}
+}
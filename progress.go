@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const progressInterval = 100 * time.Millisecond
+
+type progress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	quiet   bool
+	labels  []string
+	status  map[string]string
+	lastLen int
+	lastAt  time.Time
+}
+
+func newProgress(quiet bool, labels ...string) *progress {
+	p := &progress{
+		out:    os.Stderr,
+		quiet:  quiet,
+		labels: labels,
+		status: make(map[string]string, len(labels)),
+	}
+	for _, l := range labels {
+		p.status[l] = "waiting"
+	}
+	return p
+}
+
+func (p *progress) update(label, status string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status[label] = status
+	if time.Since(p.lastAt) >= progressInterval {
+		p.render()
+	}
+}
+
+func (p *progress) warnf(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fmt.Fprintf(p.out, "warning: "+format+"\n", args...)
+	p.render()
+}
+
+func (p *progress) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.quiet {
+		return
+	}
+	p.render()
+	fmt.Fprintln(p.out)
+	p.lastLen = 0
+}
+
+func (p *progress) line() string {
+	parts := make([]string, 0, len(p.labels))
+	for _, l := range p.labels {
+		parts = append(parts, fmt.Sprintf("%s: %s", l, p.status[l]))
+	}
+	return "  Scanning " + strings.Join(parts, " | ")
+}
+
+func (p *progress) render() {
+	if p.quiet {
+		return
+	}
+	line := p.line()
+	pad := ""
+	if n := len(line); n < p.lastLen {
+		pad = strings.Repeat(" ", p.lastLen-n)
+	}
+	fmt.Fprintf(p.out, "\r%s%s", line, pad)
+	p.lastLen = len(line)
+	p.lastAt = time.Now()
+}
+
+func (p *progress) clear() {
+	if p.quiet || p.lastLen == 0 {
+		return
+	}
+	fmt.Fprintf(p.out, "\r%s\r", strings.Repeat(" ", p.lastLen))
+	p.lastLen = 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProgress_RendersAllLabelsOnOneLine(t *testing.T) {
+	var out strings.Builder
+	p := newProgress(false, "A", "B")
+	p.out = &out
+
+	p.update("A", "3 files")
+	p.update("B", "12 files")
+	p.warnf("cannot read %s", "x")
+	p.done()
+
+	got := out.String()
+	if !strings.Contains(got, "warning: cannot read x\n") {
+		t.Errorf("warning not printed on its own line: %q", got)
+	}
+	lines := strings.Split(strings.TrimRight(got, "\n"), "\n")
+	last := lines[len(lines)-1]
+	if !strings.Contains(last, "A: 3 files | B: 12 files") {
+		t.Errorf("final progress line = %q, want both counters", last)
+	}
+}
+
+func TestProgress_Quiet(t *testing.T) {
+	var out strings.Builder
+	p := newProgress(true, "A")
+	p.out = &out
+	p.update("A", "1 files")
+	p.warnf("still shown")
+	p.done()
+
+	if got := out.String(); got != "warning: still shown\n" {
+		t.Errorf("quiet progress wrote %q, want only the warning", got)
+	}
+}
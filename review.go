@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const maxReviewTextSize = 1 << 20
+
+type reviewer struct {
+	in     *bufio.Reader
+	out    io.Writer
+	rootA  string
+	rootB  string
+	x      *syncExecutor
+	sticky map[string]byte
+	counts map[byte]int
+}
+
+func reviewKey(d diffEntry) string {
+	return fmt.Sprintf("%d %s", d.kind, detailString(d.details))
+}
+
+func reviewSymbol(d diffEntry) string {
+	switch d.kind {
+	case diffOnlyA:
+		return "-"
+	case diffOnlyB:
+		return "+"
+	case diffRenamed:
+		return "R"
+	case diffDangling:
+		return "D"
+	default:
+		return sideSymbol(d.side)
+	}
+}
+
+func reviewLabel(d diffEntry) string {
+	switch d.kind {
+	case diffOnlyA:
+		return "only in A"
+	case diffOnlyB:
+		return "only in B"
+	case diffRenamed:
+		return "renamed from " + d.entryB.relPath
+	default:
+		return detailString(d.details)
+	}
+}
+
+func reviewDiffs(diffs []diffEntry, rootA, rootB string, in io.Reader, out io.Writer) int {
+	r := &reviewer{
+		in:     bufio.NewReader(in),
+		out:    out,
+		rootA:  rootA,
+		rootB:  rootB,
+		x:      &syncExecutor{rootA: rootA, rootB: rootB},
+		sticky: make(map[string]byte),
+		counts: make(map[byte]int),
+	}
+
+	var order []int
+	for i, d := range diffs {
+		if d.kind != diffSynced {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return diffs[order[i]].relPath < diffs[order[j]].relPath
+	})
+
+	fmt.Fprintln(out, colorCyan("=== Review ==="))
+	fmt.Fprintln(out, "  a: copy A → B   b: copy B → A   s: skip   d: show diff   o: open both   q: quit")
+	fmt.Fprintln(out, "  A / B / S: apply to all remaining entries with the same detail")
+	fmt.Fprintln(out)
+
+	for n, i := range order {
+		if !r.reviewEntry(diffs, i, n+1, len(order)) {
+			break
+		}
+	}
+
+	fmt.Fprintf(out, "\nReviewed: %d copied A → B, %d copied B → A, %d skipped\n",
+		r.counts['a'], r.counts['b'], r.counts['s'])
+	if r.x.j != nil {
+		fmt.Fprintf(out, "  undo with: differ undo %s\n", r.x.j.ID)
+	}
+	return r.counts['a'] + r.counts['b']
+}
+
+func (r *reviewer) reviewEntry(diffs []diffEntry, i, n, total int) bool {
+	d := diffs[i]
+	key := reviewKey(d)
+
+	if action, ok := r.sticky[key]; ok {
+		r.apply(diffs, i, action)
+		return true
+	}
+
+	fmt.Fprintf(r.out, "[%d/%d] %s %s  (%s)\n", n, total, reviewSymbol(d), d.relPath, reviewLabel(d))
+	for {
+		fmt.Fprint(r.out, "  action [a,b,s,d,o,A,B,S,q]? ")
+		line, err := r.in.ReadString('\n')
+		choice := strings.TrimSpace(line)
+		if err != nil && choice == "" {
+			fmt.Fprintln(r.out)
+			return false
+		}
+
+		switch choice {
+		case "a", "b", "s":
+			if r.apply(diffs, i, choice[0]) {
+				return true
+			}
+		case "A", "B", "S":
+			action := strings.ToLower(choice)[0]
+			r.sticky[key] = action
+			r.apply(diffs, i, action)
+			return true
+		case "d":
+			r.showDiff(d)
+		case "o":
+			r.open(d)
+		case "q":
+			return false
+		default:
+			fmt.Fprintf(r.out, "  unknown choice %q\n", choice)
+		}
+	}
+}
+
+func (r *reviewer) apply(diffs []diffEntry, i int, action byte) bool {
+	d := diffs[i]
+	switch action {
+	case 's':
+		r.counts['s']++
+		return true
+	case 'a':
+		if d.entryA == nil {
+			fmt.Fprintf(r.out, "  %s does not exist in A\n", d.relPath)
+			return false
+		}
+		if !r.copyEntry(d.entryA, false) {
+			return false
+		}
+		diffs[i].entryB = d.entryA
+	case 'b':
+		if d.entryB == nil {
+			fmt.Fprintf(r.out, "  %s does not exist in B\n", d.relPath)
+			return false
+		}
+		if !r.copyEntry(d.entryB, true) {
+			return false
+		}
+		diffs[i].entryA = d.entryB
+	}
+	diffs[i].kind = diffSynced
+	r.counts[action]++
+	return true
+}
+
+func (r *reviewer) copyEntry(e *fileEntry, reverse bool) bool {
+	mode := e.info.Mode()
+	a := syncAction{Op: opCopy, Path: e.relPath, Mode: mode, Reverse: reverse}
+	switch {
+	case mode.IsDir():
+		a.Op = opMkdir
+		_, dst := a.paths(r.x.rootA, r.x.rootB)
+		if _, err := os.Lstat(dst); err == nil {
+			a.Op = opChmod
+		}
+	case !mode.IsRegular():
+		fmt.Fprintf(r.out, "  sync error: %s: only regular files and directories can be copied\n", e.relPath)
+		return false
+	}
+
+	if err := r.x.apply(a); err != nil {
+		fmt.Fprintf(r.out, "  %s error: %s: %s\n", a.Op, e.relPath, err)
+		return false
+	}
+	return true
+}
+
+func (r *reviewer) showDiff(d diffEntry) {
+	for _, det := range d.details {
+		fmt.Fprintf(r.out, "    %s\n", det)
+	}
+
+	if d.entryA != nil && d.entryB != nil && isDocx(d.relPath) {
+		details := d.docxDetails
+		if len(details) == 0 {
+			details = analyzeDocx(d.entryA.diskPath(r.rootA), d.entryB.diskPath(r.rootB)).details
+		}
+		for _, dd := range details {
+			fmt.Fprintln(r.out, colorYellow(fmt.Sprintf("      %-8s  %s  (%s)", categoryLabel(dd.category), dd.name, dd.reason)))
+			printTextDiff(r.out, dd.textDiff)
+		}
+		return
+	}
+
+	textA, okA := readReviewText(r.rootA, d.entryA)
+	textB, okB := readReviewText(r.rootB, d.entryB)
+	if !okA || !okB {
+		fmt.Fprintln(r.out, "    (no text diff available)")
+		return
+	}
+	if textA == textB {
+		fmt.Fprintln(r.out, "    (text identical)")
+		return
+	}
+	printTextDiff(r.out, computeTextDiff(textA, textB))
+}
+
+func readReviewText(root string, e *fileEntry) (string, bool) {
+	if e == nil {
+		return "", true
+	}
+	if !e.info.Mode().IsRegular() || e.info.Size() > maxReviewTextSize {
+		return "", false
+	}
+	data, err := os.ReadFile(e.diskPath(root))
+	if err != nil || bytes.IndexByte(data, 0) >= 0 {
+		return "", false
+	}
+	return string(data), true
+}
+
+func (r *reviewer) open(d diffEntry) {
+	var paths []string
+	if d.entryA != nil {
+		paths = append(paths, d.entryA.diskPath(r.rootA))
+	}
+	if d.entryB != nil {
+		paths = append(paths, d.entryB.diskPath(r.rootB))
+	}
+
+	for _, p := range paths {
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", p)
+		case "windows":
+			cmd = exec.Command("cmd", "/c", "start", "", p)
+		default:
+			cmd = exec.Command("xdg-open", p)
+		}
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintf(r.out, "  cannot open %s: %s\n", p, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReviewDiffs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	rootA := t.TempDir()
+	rootB := t.TempDir()
+
+	write := func(root, name, content string) *fileEntry {
+		t.Helper()
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &fileEntry{relPath: name, info: info}
+	}
+
+	a1 := write(rootA, "a1.txt", "a1")
+	a2 := write(rootA, "a2.txt", "a2")
+	a3 := write(rootA, "a3.txt", "a3")
+	changedA := write(rootA, "changed.txt", "from a")
+	changedB := write(rootB, "changed.txt", "from b, longer")
+	onlyB := write(rootB, "z.txt", "z")
+
+	diffs := []diffEntry{
+		{kind: diffOnlyA, relPath: "a1.txt", entryA: a1},
+		{kind: diffOnlyA, relPath: "a2.txt", entryA: a2},
+		{kind: diffOnlyA, relPath: "a3.txt", entryA: a3},
+		{kind: diffChanged, relPath: "changed.txt", entryA: changedA, entryB: changedB, details: []string{"size: 6 vs 14"}},
+		{kind: diffOnlyB, relPath: "z.txt", entryB: onlyB},
+	}
+
+	// a1: skip; a2: copy all remaining only-A entries; changed: B → A; z: 'a' is refused, then skip.
+	input := strings.NewReader("s\nA\nb\na\ns\n")
+	applied := reviewDiffs(diffs, rootA, rootB, input, io.Discard)
+	if applied != 3 {
+		t.Errorf("reviewDiffs applied %d actions, want 3", applied)
+	}
+
+	if _, err := os.Stat(filepath.Join(rootB, "a1.txt")); !os.IsNotExist(err) {
+		t.Errorf("a1.txt was copied although it was skipped")
+	}
+	for _, name := range []string{"a2.txt", "a3.txt"} {
+		if _, err := os.Stat(filepath.Join(rootB, name)); err != nil {
+			t.Errorf("%s was not copied to B: %v", name, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(rootA, "changed.txt")); string(data) != "from b, longer" {
+		t.Errorf("changed.txt in A = %q, want B's content", data)
+	}
+	if _, err := os.Stat(filepath.Join(rootA, "z.txt")); !os.IsNotExist(err) {
+		t.Errorf("z.txt was copied although it was skipped")
+	}
+
+	wantKinds := []diffKind{diffOnlyA, diffSynced, diffSynced, diffSynced, diffOnlyB}
+	for i, w := range wantKinds {
+		if diffs[i].kind != w {
+			t.Errorf("diffs[%d] (%s) kind = %d, want %d", i, diffs[i].relPath, diffs[i].kind, w)
+		}
+	}
+}
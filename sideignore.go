@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	ignorePolicyA            = "a"
+	ignorePolicyB            = "b"
+	ignorePolicyUnion        = "union"
+	ignorePolicyIntersection = "intersection"
+)
+
+func validIgnorePolicy(policy string) bool {
+	switch policy {
+	case ignorePolicyA, ignorePolicyB, ignorePolicyUnion, ignorePolicyIntersection:
+		return true
+	}
+	return false
+}
+
+// sideIgnorer combines both trees' ignore rules so the two walks skip the same paths.
+type sideIgnorer struct {
+	a      *ignorer
+	b      *ignorer
+	policy string
+
+	mu        sync.Mutex
+	conflicts map[string]ignoreConflict
+}
+
+// ignoreConflict records a path that only one side's rules ignore.
+type ignoreConflict struct {
+	relPath   string
+	ignoredBy string
+	excluded  bool
+}
+
+func newSideIgnorer(a, b *ignorer, policy string) *sideIgnorer {
+	return &sideIgnorer{a: a, b: b, policy: policy, conflicts: make(map[string]ignoreConflict)}
+}
+
+func (s *sideIgnorer) isExcluded(relPath, rawPath string, isDir bool) bool {
+	exA := s.a.isExcluded(relPath, rawPath, isDir)
+	exB := s.b.isExcluded(relPath, rawPath, isDir)
+
+	var excluded bool
+	switch s.policy {
+	case ignorePolicyB:
+		excluded = exB
+	case ignorePolicyUnion:
+		excluded = exA || exB
+	case ignorePolicyIntersection:
+		excluded = exA && exB
+	default:
+		excluded = exA
+	}
+
+	if exA != exB {
+		side := "A"
+		if exB {
+			side = "B"
+		}
+		s.record(ignoreConflict{relPath: relPath, ignoredBy: side, excluded: excluded})
+	}
+	return excluded
+}
+
+// record keeps one conflict per subtree.
+func (s *sideIgnorer) record(c ignoreConflict) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for dir := filepath.Dir(c.relPath); dir != "."; dir = filepath.Dir(dir) {
+		if prev, ok := s.conflicts[dir]; ok && prev.ignoredBy == c.ignoredBy {
+			return
+		}
+	}
+	s.conflicts[c.relPath] = c
+}
+
+func (s *sideIgnorer) conflictList() []ignoreConflict {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]ignoreConflict, 0, len(s.conflicts))
+	for _, c := range s.conflicts {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].relPath < list[j].relPath })
+	return list
+}
+
+func printIgnoreConflicts(out io.Writer, conflicts []ignoreConflict, policy string) {
+	if len(conflicts) == 0 {
+		return
+	}
+	fmt.Fprintln(out, colorCyan(fmt.Sprintf("=== Ignore rules disagree (policy: %s) ===", policy)))
+	for _, c := range conflicts {
+		outcome := "compared"
+		if c.excluded {
+			outcome = "skipped"
+		}
+		fmt.Fprintln(out, colorYellow(fmt.Sprintf("  %-8s  %s  (ignored only by %s's rules)", outcome, c.relPath, c.ignoredBy)))
+	}
+	fmt.Fprintln(out)
+}
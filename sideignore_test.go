@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSideIgnorer_Policies(t *testing.T) {
+	isolateGitConfig(t)
+
+	rootA, rootB := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(rootA, ".gitignore"), "*.log\nshared.tmp\n")
+	writeTestFile(t, filepath.Join(rootB, ".gitignore"), "build/\nshared.tmp\n")
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  map[string]bool
+	}{
+		{"app.log", false, map[string]bool{"a": true, "b": false, "union": true, "intersection": false}},
+		{"build", true, map[string]bool{"a": false, "b": true, "union": true, "intersection": false}},
+		{"shared.tmp", false, map[string]bool{"a": true, "b": true, "union": true, "intersection": true}},
+		{"main.go", false, map[string]bool{"a": false, "b": false, "union": false, "intersection": false}},
+	}
+	for _, policy := range []string{ignorePolicyA, ignorePolicyB, ignorePolicyUnion, ignorePolicyIntersection} {
+		s := newSideIgnorer(newIgnorer(nil, rootA, filterRules{}), newIgnorer(nil, rootB, filterRules{}), policy)
+		for _, tt := range tests {
+			if got := s.isExcluded(tt.path, tt.path, tt.isDir); got != tt.want[policy] {
+				t.Errorf("policy %s: isExcluded(%q) = %v, want %v", policy, tt.path, got, tt.want[policy])
+			}
+		}
+	}
+}
+
+func TestSideIgnorer_Conflicts(t *testing.T) {
+	isolateGitConfig(t)
+
+	rootA, rootB := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(rootA, ".gitignore"), "*.log\n")
+	writeTestFile(t, filepath.Join(rootB, ".gitignore"), "build/\n")
+	for _, root := range []string{rootA, rootB} {
+		writeTestTree(t, root, map[string]string{
+			"build/out.bin":      "x",
+			"build/sub/deep.bin": "x",
+			"app.log":            "x",
+			"main.go":            "x",
+		})
+	}
+
+	s := newSideIgnorer(newIgnorer(nil, rootA, filterRules{}), newIgnorer(nil, rootB, filterRules{}), ignorePolicyA)
+	lists, err := walkTrees([]string{rootA, rootB}, []string{"A", "B"}, s, options{quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.conflictList()
+	want := []ignoreConflict{
+		{relPath: "app.log", ignoredBy: "A", excluded: true},
+		{relPath: "build", ignoredBy: "B", excluded: false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("conflicts = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("conflict %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Under policy a, both walks see build/ and neither sees app.log.
+	for i, list := range lists {
+		var paths []string
+		for _, e := range list {
+			paths = append(paths, e.relPath)
+		}
+		joined := strings.Join(paths, " ")
+		if strings.Contains(joined, "app.log") || !strings.Contains(joined, "build/sub/deep.bin") {
+			t.Errorf("walk %d saw %q", i, joined)
+		}
+	}
+
+	var out bytes.Buffer
+	printIgnoreConflicts(&out, got, ignorePolicyA)
+	for _, line := range []string{"policy: a", "skipped   app.log  (ignored only by A's rules)", "compared  build  (ignored only by B's rules)"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("report missing %q:\n%s", line, out.String())
+		}
+	}
+}
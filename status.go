@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type mirrorPair struct {
+	component string
+	suffix    int
+	pathA     string
+	pathB     string
+}
+
+type pairStatus struct {
+	pair      mirrorPair
+	onlyA     int
+	onlyB     int
+	changed   int
+	modifiedA time.Time
+	modifiedB time.Time
+	err       error
+}
+
+func findMirrorPairs(home string, rules []mirrorRule) []mirrorPair {
+	dirEntries, err := os.ReadDir(home)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", home, err)
+		return nil
+	}
+
+	var pairs []mirrorPair
+	for _, de := range dirEntries {
+		if !de.IsDir() {
+			continue
+		}
+		component := de.Name()
+		pathA := filepath.Join(home, component)
+		for _, n := range discoverSuffixes(pathA, rules) {
+			pathB, err := computeMirrorPath(pathA, n, rules)
+			if err != nil {
+				continue
+			}
+			pairs = append(pairs, mirrorPair{component: component, suffix: n, pathA: pathA, pathB: pathB})
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].component != pairs[j].component {
+			return pairs[i].component < pairs[j].component
+		}
+		return pairs[i].suffix < pairs[j].suffix
+	})
+	return pairs
+}
+
+func latestModTime(list []fileEntry) time.Time {
+	var latest time.Time
+	for _, e := range list {
+		if e.info.ModTime().After(latest) {
+			latest = e.info.ModTime()
+		}
+	}
+	return latest
+}
+
+func checkPair(cfg config, pair mirrorPair) pairStatus {
+	st := pairStatus{pair: pair}
+	opts := options{quiet: true, skipDocx: true, noRenames: true}
+	ignorer := newSideIgnorer(newIgnorer(cfg.AlwaysExclude, pair.pathA, filterRules{}), newIgnorer(cfg.AlwaysExclude, pair.pathB, filterRules{}), cfg.IgnorePolicy)
+
+	lists, err := walkTrees([]string{pair.pathA, pair.pathB}, []string{"A", "B"}, ignorer, opts)
+	if err != nil {
+		st.err = err
+		return st
+	}
+	listA, listB := lists[0], lists[1]
+
+	for _, d := range computeDiff(listA, listB, pair.pathA, pair.pathB, opts) {
+		switch d.kind {
+		case diffOnlyA:
+			st.onlyA++
+		case diffOnlyB:
+			st.onlyB++
+		case diffChanged, diffRenamed, diffDangling:
+			st.changed++
+		}
+	}
+	st.modifiedA = latestModTime(listA)
+	st.modifiedB = latestModTime(listB)
+	return st
+}
+
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func runStatus(cfg config, args []string) int {
+	fs := newFlagSet("status")
+	positional, err := parseCommandLine(fs, args)
+	if err != nil {
+		return reportUsageError("status", err)
+	}
+	if len(positional) > 0 {
+		return reportUsageError("status", fmt.Errorf("unexpected argument %q", positional[0]))
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot determine home directory: %s\n", err)
+		return exitUsageErr
+	}
+
+	pairs := findMirrorPairs(home, cfg.Mirrors)
+	if len(pairs) == 0 {
+		fmt.Printf("No mirrored directories found in %s.\n", home)
+		return exitOK
+	}
+
+	pairMax := len("PAIR")
+	for _, p := range pairs {
+		label := fmt.Sprintf("%s ↔ .%d", p.component, p.suffix)
+		if n := len([]rune(label)); n > pairMax {
+			pairMax = n
+		}
+	}
+
+	header := fmt.Sprintf("  %-*s  %7s  %7s  %7s  %-16s  %-16s", pairMax, "PAIR", "ONLY_A", "ONLY_B", "CHANGED", "MODIFIED_A", "MODIFIED_B")
+	fmt.Println(colorCyan(header))
+	fmt.Println(colorCyan(strings.Repeat("-", termWidth())))
+
+	drifted := 0
+	for _, p := range pairs {
+		fmt.Fprintf(os.Stderr, "\r  Checking %s.%d...", p.component, p.suffix)
+		st := checkPair(cfg, p)
+		fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", len(p.component)+24))
+
+		label := fmt.Sprintf("%s ↔ .%d", p.component, p.suffix)
+		label += strings.Repeat(" ", pairMax-len([]rune(label)))
+		if st.err != nil {
+			fmt.Println(colorRed(fmt.Sprintf("  %s  error: %s", label, st.err)))
+			drifted++
+			continue
+		}
+
+		line := fmt.Sprintf("  %s  %7d  %7d  %7d  %-16s  %-16s", label, st.onlyA, st.onlyB, st.changed,
+			formatStatusTime(st.modifiedA), formatStatusTime(st.modifiedB))
+		if st.onlyA+st.onlyB+st.changed == 0 {
+			fmt.Println(colorGreen(line))
+		} else {
+			fmt.Println(colorYellow(line))
+			drifted++
+		}
+	}
+	fmt.Println()
+
+	fmt.Printf("Summary: %d pairs, %d drifted\n", len(pairs), drifted)
+	if drifted > 0 {
+		return exitDiff
+	}
+	return exitOK
+}
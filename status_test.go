@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindMirrorPairs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, name := range []string{"work", "work.2", "work.3", "notes", "proj", "proj.2", "lonely.2"} {
+		if err := os.Mkdir(filepath.Join(home, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pairs := findMirrorPairs(home, nil)
+	want := []struct {
+		component string
+		suffix    int
+	}{{"proj", 2}, {"work", 2}, {"work", 3}}
+	if len(pairs) != len(want) {
+		t.Fatalf("findMirrorPairs returned %d pairs, want %d: %+v", len(pairs), len(want), pairs)
+	}
+	for i, w := range want {
+		if pairs[i].component != w.component || pairs[i].suffix != w.suffix {
+			t.Errorf("pairs[%d] = %s.%d, want %s.%d", i, pairs[i].component, pairs[i].suffix, w.component, w.suffix)
+		}
+	}
+	if pairs[0].pathB != filepath.Join(home, "proj.2") {
+		t.Errorf("pairs[0].pathB = %q, want %q", pairs[0].pathB, filepath.Join(home, "proj.2"))
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, "backup.4", "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pairs = findMirrorPairs(home, []mirrorRule{{Template: "{home}/backup.{n}/{rel}"}})
+	if len(pairs) != 1 || pairs[0].component != "notes" || pairs[0].suffix != 4 || pairs[0].pathB != filepath.Join(home, "backup.4", "notes") {
+		t.Errorf("findMirrorPairs with a template rule = %+v, want notes paired with backup.4/notes", pairs)
+	}
+}
+
+func TestCheckPair_SkipsRenames(t *testing.T) {
+	pair := mirrorPair{pathA: t.TempDir(), pathB: t.TempDir()}
+	writeTestFile(t, filepath.Join(pair.pathA, "new", "f.txt"), "moved")
+	writeTestFile(t, filepath.Join(pair.pathB, "old", "f.txt"), "moved")
+
+	st := checkPair(defaultConfig(), pair)
+	if st.err != nil || st.onlyA != 2 || st.onlyB != 2 || st.changed != 0 {
+		t.Errorf("checkPair = %+v, want only-A and only-B entries instead of a rename", st)
+	}
+}
+
+func TestLatestModTime(t *testing.T) {
+	t1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	list := []fileEntry{
+		{relPath: "a", info: fakeInfo{mod: t1}},
+		{relPath: "b", info: fakeInfo{mod: t2}},
+	}
+	if got := latestModTime(list); !got.Equal(t2) {
+		t.Errorf("latestModTime = %v, want %v", got, t2)
+	}
+	if got := latestModTime(nil); !got.IsZero() {
+		t.Errorf("latestModTime(nil) = %v, want zero", got)
+	}
+}
@@ -1,87 +1,448 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	appkit "github.com/TrueBlocks/trueblocks-art/packages/appkit/v2"
 )
 
-func syncDocxNotText(diffs []diffEntry, rootA, rootB string) {
-	var synced int
+const (
+	opMkdir  = "mkdir"
+	opCopy   = "copy"
+	opChmod  = "chmod"
+	opDelete = "delete"
+	opRmdir  = "rmdir"
+	opRename = "rename"
+)
+
+type syncAction struct {
+	Op      string      `json:"op"`
+	Path    string      `json:"path"`
+	From    string      `json:"from,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	Reverse bool        `json:"reverse,omitempty"`
+	Target  *fileState  `json:"target,omitempty"`
+	index   int
+}
+
+// fileState is what a copy or delete expects to find at its destination.
+type fileState struct {
+	Exists   bool      `json:"exists"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Followed bool      `json:"followed,omitempty"`
+}
+
+func stateOf(e *fileEntry) *fileState {
+	if e == nil {
+		return &fileState{}
+	}
+	followed := e.target != "" && e.info.Mode()&os.ModeSymlink == 0
+	return &fileState{Exists: true, Size: e.info.Size(), ModTime: e.info.ModTime(), Followed: followed}
+}
+
+func (s *fileState) matches(path string) bool {
+	stat := os.Lstat
+	if s.Followed {
+		stat = os.Stat
+	}
+	info, err := stat(path)
+	if err != nil {
+		return !s.Exists && os.IsNotExist(err)
+	}
+	return s.Exists && info.Size() == s.Size && info.ModTime().Equal(s.ModTime)
+}
+
+type syncPlan struct {
+	RootA   string       `json:"rootA"`
+	RootB   string       `json:"rootB"`
+	Created time.Time    `json:"created"`
+	Actions []syncAction `json:"actions"`
+}
+
+type planOptions struct {
+	full   bool
+	delete bool
+}
+
+func (a syncAction) direction() string {
+	if a.Reverse {
+		return "B → A"
+	}
+	return "A → B"
+}
+
+func (a syncAction) paths(rootA, rootB string) (src, dst string) {
+	if a.Op == opRename { // both paths are under rootB
+		return onDiskPath(rootB, a.From), onDiskPath(rootB, a.Path)
+	}
+	src = onDiskPath(rootA, a.Path)
+	dst = onDiskPath(rootB, a.Path)
+	if a.Reverse {
+		src, dst = dst, src
+	}
+	return src, dst
+}
+
+func planSync(diffs []diffEntry, po planOptions) []syncAction {
+	if !po.full {
+		return planAuto(diffs)
+	}
+
+	var mkdirs, renames, copies, chmods, deletes []syncAction
+	for i, d := range diffs {
+		switch d.kind {
+		case diffRenamed:
+			// Without --delete the old name in B survives, so copy instead.
+			if po.delete {
+				renames = append(renames, syncAction{Op: opRename, Path: d.relPath, From: d.entryB.relPath, Mode: d.entryA.info.Mode(), index: i})
+			} else {
+				copies = append(copies, syncAction{Op: opCopy, Path: d.relPath, Mode: d.entryA.info.Mode(), Target: stateOf(nil), index: i})
+			}
+		case diffOnlyA:
+			mode := d.entryA.info.Mode()
+			switch {
+			case mode.IsDir():
+				mkdirs = append(mkdirs, syncAction{Op: opMkdir, Path: d.relPath, Mode: mode, index: i})
+			case mode.IsRegular():
+				copies = append(copies, syncAction{Op: opCopy, Path: d.relPath, Mode: mode, Target: stateOf(nil), index: i})
+			}
+		case diffOnlyB:
+			if !po.delete {
+				continue
+			}
+			a := syncAction{Op: opDelete, Path: d.relPath, Target: stateOf(d.entryB), index: i}
+			if d.entryB.info.IsDir() {
+				a.Op, a.Target = opRmdir, nil
+			}
+			deletes = append(deletes, a)
+		case diffChanged:
+			if d.side == sideBoth || isSpecial(d.entryA.info.Mode()) || isSpecial(d.entryB.info.Mode()) {
+				continue
+			}
+			src, dst := d.entryA, d.entryB
+			if d.side == sideB {
+				src, dst = dst, src
+			}
+			a := syncAction{Path: d.relPath, Mode: src.info.Mode(), Reverse: d.side == sideB, index: i}
+			switch {
+			case src.info.Mode().IsRegular() && dst.info.Mode().IsRegular() && !modeOnly(d.details):
+				a.Op = opCopy
+				a.Target = stateOf(dst)
+				copies = append(copies, a)
+			case hasDetail(d.details, "mode:"):
+				a.Op = opChmod
+				chmods = append(chmods, a)
+			}
+		}
+	}
+
+	sort.Slice(mkdirs, func(i, j int) bool { return mkdirs[i].Path < mkdirs[j].Path })
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Path > deletes[j].Path })
+
+	actions := append(mkdirs, renames...)
+	actions = append(actions, copies...)
+	actions = append(actions, chmods...)
+	return append(actions, deletes...)
+}
+
+func planAuto(diffs []diffEntry) []syncAction {
+	actions := planDocxNotText(diffs)
+	copied := make(map[int]bool, len(actions))
+	for _, a := range actions {
+		copied[a.index] = true
+	}
+	for _, a := range planModes(diffs) {
+		if !copied[a.index] {
+			actions = append(actions, a)
+		}
+	}
+	return actions
+}
+
+func hasDetail(details []string, prefix string) bool {
+	for _, det := range details {
+		if strings.HasPrefix(det, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func modeOnly(details []string) bool {
+	for _, det := range details {
+		if !strings.HasPrefix(det, "mode:") && !strings.HasPrefix(det, "modified:") && !strings.HasPrefix(det, "name:") {
+			return false
+		}
+	}
+	return true
+}
+
+func planDocxNotText(diffs []diffEntry) []syncAction {
+	var actions []syncAction
 	for i, d := range diffs {
 		if d.kind != diffChanged {
 			continue
 		}
+		if d.side == sideBoth {
+			continue
+		}
 		detail := detailString(d.details)
 		if detail != "docx:not-text" && detail != "docx:identical" {
 			continue
 		}
-
-		srcPath := filepath.Join(rootA, d.relPath)
-		dstPath := filepath.Join(rootB, d.relPath)
-
-		if err := appkit.CopyFile(srcPath, dstPath); err != nil {
-			fmt.Fprintf(os.Stderr, "  sync error: %s: %s\n", d.relPath, err)
-			continue
+		dst := d.entryB
+		if d.side == sideB {
+			dst = d.entryA
 		}
-
-		fmt.Fprintf(os.Stderr, "  synced: %s\n", d.relPath)
-		synced++
-		diffs[i].kind = diffSynced
-	}
-	if synced > 0 {
-		fmt.Fprintf(os.Stderr, "  %d files synced (A → B)\n\n", synced)
+		actions = append(actions, syncAction{Op: opCopy, index: i, Path: d.relPath, Reverse: d.side == sideB, Target: stateOf(dst)})
 	}
+	return actions
 }
 
-func syncModes(diffs []diffEntry, rootA, rootB string) {
-	var fixed int
+func planModes(diffs []diffEntry) []syncAction {
+	var actions []syncAction
 	for i, d := range diffs {
 		if d.kind != diffChanged {
 			continue
 		}
-		if d.entryA == nil {
+		if d.entryA == nil || d.entryB == nil || d.side == sideBoth {
 			continue
 		}
-
-		hasMode := false
-		for _, det := range d.details {
-			if strings.HasPrefix(det, "mode:") {
-				hasMode = true
-				break
-			}
+		if isSpecial(d.entryA.info.Mode()) || isSpecial(d.entryB.info.Mode()) {
+			continue
 		}
-		if !hasMode {
+		if !hasDetail(d.details, "mode:") {
 			continue
 		}
 
-		dstPath := filepath.Join(rootB, d.relPath)
-		modeA := d.entryA.info.Mode()
-		if err := os.Chmod(dstPath, modeA); err != nil {
-			fmt.Fprintf(os.Stderr, "  chmod error: %s: %s\n", d.relPath, err)
-			continue
+		a := syncAction{Op: opChmod, index: i, Path: d.relPath, Mode: d.entryA.info.Mode()}
+		if d.side == sideB {
+			a.Reverse = true
+			a.Mode = d.entryB.info.Mode()
 		}
+		actions = append(actions, a)
+	}
+	return actions
+}
 
-		fmt.Fprintf(os.Stderr, "  chmod: %s → %s\n", d.relPath, modeA)
-		fixed++
+func newSyncPlan(rootA, rootB string, actions []syncAction) *syncPlan {
+	return &syncPlan{RootA: rootA, RootB: rootB, Created: time.Now(), Actions: actions}
+}
 
-		var remaining []string
-		for _, det := range diffs[i].details {
-			if !strings.HasPrefix(det, "mode:") {
-				remaining = append(remaining, det)
+func loadSyncPlan(path string) (*syncPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p syncPlan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("cannot parse plan %s: %w", path, err)
+	}
+	if p.RootA == "" || p.RootB == "" {
+		return nil, fmt.Errorf("plan %s does not name both roots", path)
+	}
+	for i := range p.Actions {
+		p.Actions[i].index = -1
+		a := p.Actions[i]
+		if !filepath.IsLocal(a.Path) || (a.From != "" && !filepath.IsLocal(a.From)) {
+			return nil, fmt.Errorf("plan %s: %s of %q leaves the tree", path, a.Op, a.Path)
+		}
+		switch p.Actions[i].Op {
+		case opMkdir, opCopy, opChmod, opDelete, opRmdir:
+		case opRename:
+			if p.Actions[i].From == "" {
+				return nil, fmt.Errorf("plan %s: rename of %q has no source", path, p.Actions[i].Path)
 			}
+		default:
+			return nil, fmt.Errorf("plan %s: unknown op %q", path, p.Actions[i].Op)
 		}
-		if len(remaining) == 0 {
-			diffs[i].kind = diffSynced
-		} else {
-			diffs[i].details = remaining
+	}
+	return &p, nil
+}
+
+func (p *syncPlan) writeJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+type syncExecutor struct {
+	rootA string
+	rootB string
+	j     *journal
+}
+
+func (x *syncExecutor) apply(a syncAction) error {
+	if x.j == nil {
+		j, err := newJournal(x.rootA, x.rootB)
+		if err != nil {
+			return fmt.Errorf("cannot create undo journal: %w", err)
 		}
+		x.j = j
 	}
-	if fixed > 0 {
-		fmt.Fprintf(os.Stderr, "  %d modes fixed (A → B)\n\n", fixed)
+
+	src, dst := a.paths(x.rootA, x.rootB)
+	if a.Target != nil && (a.Op == opCopy || a.Op == opDelete) && !a.Target.matches(dst) {
+		return fmt.Errorf("%s changed since the plan was made", dst)
 	}
+	switch a.Op {
+	case opMkdir:
+		if info, err := os.Stat(dst); err == nil && info.IsDir() {
+			return nil
+		}
+		if err := os.Mkdir(dst, a.Mode.Perm()); err != nil {
+			return err
+		}
+		x.j.record(journalAction{Op: opMkdir, Path: dst, Created: true})
+	case opCopy:
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is a %s, only regular files are copied", src, fileType(info.Mode()))
+		}
+		ja, err := x.j.preserve(dst)
+		if err != nil {
+			return err
+		}
+		if err := appkit.CopyFile(src, dst); err != nil {
+			x.j.restore(ja)
+			return err
+		}
+		x.j.record(ja)
+		if a.Mode != 0 {
+			if err := os.Chmod(dst, a.Mode); err != nil {
+				return err
+			}
+		}
+	case opChmod:
+		info, err := os.Lstat(dst)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(dst, a.Mode); err != nil {
+			return err
+		}
+		x.j.record(journalAction{Op: opChmod, Path: dst, OldMode: info.Mode()})
+	case opDelete:
+		ja, err := x.j.preserve(dst)
+		if err != nil {
+			return err
+		}
+		ja.Op = opDelete
+		x.j.record(ja)
+	case opRmdir:
+		info, err := os.Lstat(dst)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+		x.j.record(journalAction{Op: opRmdir, Path: dst, OldMode: info.Mode()})
+	case opRename:
+		info, err := os.Lstat(src)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(dst); err == nil {
+			return fmt.Errorf("%s already exists", dst)
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+		x.j.record(journalAction{Op: opRename, Path: dst, From: src})
+		if a.Mode != 0 && a.Mode != info.Mode() {
+			if err := os.Chmod(dst, a.Mode); err != nil {
+				return err
+			}
+			x.j.record(journalAction{Op: opChmod, Path: dst, OldMode: info.Mode()})
+		}
+	default:
+		return fmt.Errorf("unknown op %q", a.Op)
+	}
+	return nil
+}
+
+func applySync(diffs []diffEntry, actions []syncAction, rootA, rootB string) int {
+	if len(actions) == 0 {
+		return 0
+	}
+
+	x := &syncExecutor{rootA: rootA, rootB: rootB}
+	var applied, failed int
+	for _, a := range actions {
+		if err := x.apply(a); err != nil {
+			fmt.Fprintf(os.Stderr, "  %s error: %s: %s\n", a.Op, a.Path, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  %s: %s (%s)\n", a.Op, a.Path, a.direction())
+		applied++
+		if a.index >= 0 && diffs != nil {
+			markSynced(diffs, a)
+		}
+	}
+
+	if applied > 0 {
+		fmt.Fprintf(os.Stderr, "  %d actions applied", applied)
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, ", %d failed", failed)
+		}
+		fmt.Fprintf(os.Stderr, "\n  undo with: differ undo %s\n\n", x.j.ID)
+	} else if failed > 0 {
+		fmt.Fprintf(os.Stderr, "  %d actions failed\n\n", failed)
+	}
+	return failed
 }
 
+func markSynced(diffs []diffEntry, a syncAction) {
+	d := &diffs[a.index]
+	if a.Op != opChmod {
+		d.kind = diffSynced
+		return
+	}
+
+	var remaining []string
+	for _, det := range d.details {
+		if !strings.HasPrefix(det, "mode:") {
+			remaining = append(remaining, det)
+		}
+	}
+	if len(remaining) == 0 {
+		d.kind = diffSynced
+	} else {
+		d.details = remaining
+	}
+}
+
+func printSyncPlan(title string, actions []syncAction) {
+	if len(actions) == 0 {
+		return
+	}
+
+	fmt.Println(colorCyan(fmt.Sprintf("=== %s ===", title)))
+	for _, a := range actions {
+		switch a.Op {
+		case opChmod, opMkdir:
+			fmt.Printf("  %-6s  %s  → %s  (%s)\n", a.Op, a.Path, a.Mode, a.direction())
+		case opRename:
+			fmt.Printf("  %-6s  %s  → %s  (in B)\n", a.Op, a.From, a.Path)
+		default:
+			fmt.Printf("  %-6s  %s  (%s)\n", a.Op, a.Path, a.direction())
+		}
+	}
+	fmt.Println()
+}
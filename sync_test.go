@@ -0,0 +1,271 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanSync(t *testing.T) {
+	diffs := []diffEntry{
+		{kind: diffChanged, relPath: "a.docx", entryA: &fileEntry{info: fakeInfo{mode: 0644}},
+			details: []string{"size: 1 vs 2", "docx:not-text"}},
+		{kind: diffChanged, relPath: "b.sh", entryA: &fileEntry{info: fakeInfo{mode: 0755}}, entryB: &fileEntry{info: fakeInfo{mode: 0644}},
+			details: []string{"mode: -rwxr-xr-x vs -rw-r--r--"}},
+		{kind: diffChanged, relPath: "c.docx", entryA: &fileEntry{info: fakeInfo{mode: 0644}},
+			details: []string{"size: 1 vs 2", "docx:text"}},
+		{kind: diffOnlyA, relPath: "d.txt", entryA: &fileEntry{info: fakeInfo{mode: 0644}}},
+	}
+
+	actions := planSync(diffs, planOptions{})
+	if len(actions) != 2 {
+		t.Fatalf("planSync returned %d actions, want 2: %+v", len(actions), actions)
+	}
+	if actions[0].Op != opCopy || actions[0].Path != "a.docx" {
+		t.Errorf("actions[0] = %+v, want copy of a.docx", actions[0])
+	}
+	if actions[1].Op != opChmod || actions[1].Path != "b.sh" || actions[1].Mode != 0755 {
+		t.Errorf("actions[1] = %+v, want chmod of b.sh to 0755", actions[1])
+	}
+	for i, d := range diffs {
+		if d.kind == diffSynced {
+			t.Errorf("diffs[%d] was marked synced by planning alone", i)
+		}
+	}
+}
+
+func TestPlanSync_HonorsChangeSide(t *testing.T) {
+	modeDiff := []string{"mode: -rwxr-xr-x vs -rw-r--r--"}
+	diffs := []diffEntry{
+		{kind: diffChanged, relPath: "a.sh", side: sideA, details: modeDiff,
+			entryA: &fileEntry{info: fakeInfo{mode: 0755}}, entryB: &fileEntry{info: fakeInfo{mode: 0644}}},
+		{kind: diffChanged, relPath: "b.sh", side: sideB, details: modeDiff,
+			entryA: &fileEntry{info: fakeInfo{mode: 0755}}, entryB: &fileEntry{info: fakeInfo{mode: 0644}}},
+		{kind: diffChanged, relPath: "c.sh", side: sideBoth, details: modeDiff,
+			entryA: &fileEntry{info: fakeInfo{mode: 0755}}, entryB: &fileEntry{info: fakeInfo{mode: 0644}}},
+	}
+
+	actions := planSync(diffs, planOptions{})
+	if len(actions) != 2 {
+		t.Fatalf("planSync returned %d actions, want 2 (conflict skipped): %+v", len(actions), actions)
+	}
+	if actions[0].Reverse || actions[0].Mode != 0755 {
+		t.Errorf("actions[0] = %+v, want A → B chmod to 0755", actions[0])
+	}
+	if !actions[1].Reverse || actions[1].Mode != 0644 {
+		t.Errorf("actions[1] = %+v, want B → A chmod to 0644", actions[1])
+	}
+}
+
+func TestPlanSync_Full(t *testing.T) {
+	dir := fakeInfo{mode: 0755 | os.ModeDir, dir: true}
+	file := fakeInfo{mode: 0644, size: 1}
+	diffs := []diffEntry{
+		{kind: diffOnlyA, relPath: "new/sub", entryA: &fileEntry{info: dir}},
+		{kind: diffOnlyA, relPath: "new", entryA: &fileEntry{info: dir}},
+		{kind: diffOnlyA, relPath: "new/f.txt", entryA: &fileEntry{info: file}},
+		{kind: diffOnlyB, relPath: "old", entryB: &fileEntry{info: dir}},
+		{kind: diffOnlyB, relPath: "old/f.txt", entryB: &fileEntry{info: file}},
+		{kind: diffChanged, relPath: "edit.txt", details: []string{"size: 1 vs 2"},
+			entryA: &fileEntry{info: file}, entryB: &fileEntry{info: fakeInfo{mode: 0644, size: 2}}},
+		{kind: diffChanged, relPath: "run.sh", details: []string{"mode: -rwxr-xr-x vs -rw-r--r--"},
+			entryA: &fileEntry{info: fakeInfo{mode: 0755}}, entryB: &fileEntry{info: file}},
+		{kind: diffChanged, relPath: "both.txt", side: sideBoth, details: []string{"size: 1 vs 2"},
+			entryA: &fileEntry{info: file}, entryB: &fileEntry{info: file}},
+		{kind: diffRenamed, relPath: "new/moved.txt",
+			entryA: &fileEntry{relPath: "new/moved.txt", info: file}, entryB: &fileEntry{relPath: "old/moved.txt", info: file}},
+	}
+
+	got := planSync(diffs, planOptions{full: true, delete: true})
+	want := []string{
+		"mkdir new", "mkdir new/sub",
+		"rename new/moved.txt",
+		"copy new/f.txt", "copy edit.txt",
+		"chmod run.sh",
+		"delete old/f.txt", "rmdir old",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("planSync returned %d actions, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if s := got[i].Op + " " + got[i].Path; s != w {
+			t.Errorf("actions[%d] = %q, want %q", i, s, w)
+		}
+	}
+
+	if got[2].From != "old/moved.txt" {
+		t.Errorf("rename source = %q, want old/moved.txt", got[2].From)
+	}
+
+	noDelete := planSync(diffs, planOptions{full: true})
+	for _, a := range noDelete {
+		if a.Op == opDelete || a.Op == opRmdir || a.Op == opRename {
+			t.Errorf("planSync without delete produced %s %s", a.Op, a.Path)
+		}
+	}
+}
+
+func TestSyncExecutor_RenameAndUndo(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	rootB := t.TempDir()
+	if err := os.WriteFile(filepath.Join(rootB, "old.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	actions := []syncAction{{Op: opRename, Path: "new.txt", From: "old.txt", Mode: 0600, index: -1}}
+	if failed := applySync(nil, actions, t.TempDir(), rootB); failed != 0 {
+		t.Fatalf("applySync reported %d failures", failed)
+	}
+	info, err := os.Stat(filepath.Join(rootB, "new.txt"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("new.txt in B: info %v, err %v; want mode 0600", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(rootB, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("old.txt still exists in B (err %v)", err)
+	}
+
+	journals, _ := listJournals()
+	if len(journals) != 1 || journals[0].undo() != 0 {
+		t.Fatalf("undo of the rename failed")
+	}
+	info, err = os.Stat(filepath.Join(rootB, "old.txt"))
+	if err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("old.txt after undo: info %v, err %v; want mode 0644", info, err)
+	}
+}
+
+func TestSyncPlan_RoundTripAndApply(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	rootA := t.TempDir()
+	rootB := t.TempDir()
+	if err := os.Mkdir(filepath.Join(rootA, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootA, "d", "f.txt"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootB, "stale.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newSyncPlan(rootA, rootB, []syncAction{
+		{Op: opMkdir, Path: "d", Mode: 0755 | os.ModeDir},
+		{Op: opCopy, Path: "d/f.txt", Mode: 0600},
+		{Op: opDelete, Path: "stale.txt"},
+	})
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+	f, err := os.Create(planFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.writeJSON(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	loaded, err := loadSyncPlan(planFile)
+	if err != nil {
+		t.Fatalf("loadSyncPlan: %v", err)
+	}
+	if len(loaded.Actions) != 3 || loaded.RootA != rootA || loaded.RootB != rootB {
+		t.Fatalf("loaded plan = %+v, want the written plan", loaded)
+	}
+
+	if failed := applySync(nil, loaded.Actions, loaded.RootA, loaded.RootB); failed != 0 {
+		t.Fatalf("applySync reported %d failures", failed)
+	}
+	info, err := os.Stat(filepath.Join(rootB, "d", "f.txt"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("d/f.txt in B: info %v, err %v; want mode 0600", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(rootB, "stale.txt")); !os.IsNotExist(err) {
+		t.Errorf("stale.txt still exists in B (err %v)", err)
+	}
+
+	journals, _ := listJournals()
+	if len(journals) != 1 || journals[0].undo() != 0 {
+		t.Fatalf("undo of the applied plan failed")
+	}
+	if _, err := os.Stat(filepath.Join(rootB, "d")); !os.IsNotExist(err) {
+		t.Errorf("d still exists in B after undo (err %v)", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(rootB, "stale.txt")); err != nil || string(data) != "x" {
+		t.Errorf("stale.txt after undo = %q (err %v), want %q", data, err, "x")
+	}
+}
+
+func TestLoadSyncPlan_RejectsUnknownOp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	data := `{"rootA": "/a", "rootB": "/b", "actions": [{"op": "explode", "path": "x"}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSyncPlan(path); err == nil {
+		t.Error("loadSyncPlan accepted an unknown op")
+	}
+}
+
+func TestLoadSyncPlan_RejectsPathsOutsideTheTree(t *testing.T) {
+	for _, action := range []string{
+		`{"op": "copy", "path": "../../etc/passwd"}`,
+		`{"op": "delete", "path": "/etc/passwd"}`,
+		`{"op": "rename", "path": "ok.txt", "from": "../outside.txt"}`,
+	} {
+		path := filepath.Join(t.TempDir(), "plan.json")
+		data := `{"rootA": "/a", "rootB": "/b", "actions": [` + action + `]}`
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadSyncPlan(path); err == nil {
+			t.Errorf("loadSyncPlan accepted %s", action)
+		}
+	}
+}
+
+func TestFileState_FollowedSymlink(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "real.txt"), "content")
+	if err := os.Symlink("real.txt", filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, follow := range []bool{false, true} {
+		entries, err := walkTree(root, newIgnorer(nil, root, filterRules{}), "B", options{follow: follow}, newProgress(true, "B"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range entries {
+			e := &entries[i]
+			if !stateOf(e).matches(e.diskPath(root)) {
+				t.Errorf("follow=%v: state of unchanged %s does not match", follow, e.relPath)
+			}
+		}
+	}
+}
+
+func TestSyncExecutor_RefusesStaleTarget(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	rootA, rootB := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(rootA, "f.txt"), "from A")
+	writeTestFile(t, filepath.Join(rootB, "f.txt"), "planned")
+	info, err := os.Stat(filepath.Join(rootB, "f.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	planned := &fileState{Exists: true, Size: info.Size(), ModTime: info.ModTime()}
+
+	writeTestFile(t, filepath.Join(rootB, "f.txt"), "edited after planning")
+	x := &syncExecutor{rootA: rootA, rootB: rootB}
+	for _, a := range []syncAction{
+		{Op: opCopy, Path: "f.txt", Target: planned},
+		{Op: opDelete, Path: "f.txt", Target: planned},
+		{Op: opCopy, Path: "f.txt", Target: &fileState{}},
+	} {
+		if err := x.apply(a); err == nil {
+			t.Errorf("%s with a stale target was applied", a.Op)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(rootB, "f.txt")); string(data) != "edited after planning" {
+		t.Errorf("f.txt in B = %q, want the later edit kept", data)
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"path/filepath"
+	"testing"
 	"time"
 )
 
@@ -25,3 +27,32 @@ func (f fakeInfo) ModTime() time.Time {
 }
 func (f fakeInfo) IsDir() bool      { return f.dir }
 func (f fakeInfo) Sys() interface{} { return nil }
+
+// writeTestFile creates path and any missing parent directories.
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// isolateGitConfig points HOME and XDG_CONFIG_HOME at an empty directory,
+// which it returns, so the user's git excludes stay out of the test.
+func isolateGitConfig(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	return home
+}
+
+// writeTestTree writes files, keyed by slash-separated path, under root.
+func writeTestTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		writeTestFile(t, filepath.Join(root, filepath.FromSlash(rel)), content)
+	}
+}
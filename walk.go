@@ -7,79 +7,238 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"sync"
 
 	"golang.org/x/text/unicode/norm"
 )
 
 type fileEntry struct {
-	relPath string
-	info    os.FileInfo
-	hash    string
+	relPath  string // NFC-normalized
+	rawPath  string // as spelled on disk
+	info     os.FileInfo
+	hash     string
+	target   string
+	dangling bool
+	linkID   string
 }
 
-func walkTree(root string, ig *ignorer, label string, opts options) ([]fileEntry, error) {
-	var entries []fileEntry
-	count := 0
+// diskPath joins the entry's on-disk spelling onto root.
+func (e *fileEntry) diskPath(root string) string {
+	if e.rawPath == "" {
+		return filepath.Join(root, e.relPath)
+	}
+	return filepath.Join(root, e.rawPath)
+}
+
+func walkTrees(roots, labels []string, ig pathFilter, opts options) ([][]fileEntry, error) {
+	prog := newProgress(opts.quiet, labels...)
+	opts.hashSlots = make(chan struct{}, hashJobs(opts))
+	lists := make([][]fileEntry, len(roots))
+	errs := make([]error, len(roots))
+
+	var wg sync.WaitGroup
+	for i := range roots {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lists[i], errs[i] = walkTree(roots[i], ig, labels[i], opts, prog)
+		}(i)
+	}
+	wg.Wait()
+	prog.done()
 
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+	for i, err := range errs {
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", path, err)
-			return nil
+			return nil, fmt.Errorf("walking %s: %w", roots[i], err)
 		}
+	}
+	return lists, nil
+}
 
-		if path == root {
-			return nil
-		}
+type treeWalker struct {
+	ig      pathFilter
+	label   string
+	opts    options
+	prog    *progress
+	entries []fileEntry
+	paths   []string
+	// active is the directory chain being read, for symlink cycle checks.
+	active []os.FileInfo
+}
+
+func walkTree(root string, ig pathFilter, label string, opts options, prog *progress) ([]fileEntry, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &treeWalker{ig: ig, label: label, opts: opts, prog: prog}
+	if info.IsDir() {
+		w.active = append(w.active, info)
+		w.walkDir(root, "")
+	}
 
-		rel, err := filepath.Rel(root, path)
+	for _, warning := range resolveCollisions(w.entries) {
+		prog.warnf("%s: %s", label, warning)
+	}
+	if opts.useHashes {
+		hashEntries(w.entries, w.paths, label, opts, prog)
+	}
+	prog.update(label, fmt.Sprintf("%d files, done", len(w.entries)))
+
+	entries := w.entries
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].relPath < entries[j].relPath
+	})
+
+	return entries, nil
+}
+
+func (w *treeWalker) walkDir(dir, rel string) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		w.prog.warnf("%s: %v", dir, err)
+		return
+	}
+
+	for _, de := range dirEntries {
+		path := filepath.Join(dir, de.Name())
+		rawRel := filepath.Join(rel, de.Name())
+		childRel := norm.NFC.String(rawRel)
+
+		info, err := os.Lstat(path)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: cannot compute relative path for %s: %v\n", path, err)
-			return nil
+			w.prog.warnf("%s: %v", path, err)
+			continue
 		}
-		rel = norm.NFC.String(rel)
 
-		isDir := info.IsDir()
-		if ig.isExcluded(rel, isDir) {
-			if isDir {
-				return filepath.SkipDir
+		e := fileEntry{relPath: childRel, rawPath: rawRel, info: info}
+		var resolved os.FileInfo
+		if info.Mode()&os.ModeSymlink != 0 {
+			if e.target, err = os.Readlink(path); err != nil {
+				w.prog.warnf("cannot read symlink %s: %v", path, err)
+			}
+			if resolved, err = os.Stat(path); err != nil {
+				e.dangling = true
+				resolved = nil
 			}
-			return nil
 		}
 
-		count++
-		entry := fileEntry{
-			relPath: rel,
-			info:    info,
-		}
-		if opts.useHashes && !isDir {
-			fmt.Fprintf(os.Stderr, "\r  Scanning %s: %d files (hashing)...", label, count)
-			h, err := hashFile(path)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "warning: cannot hash %s: %v\n", rel, err)
+		if resolved != nil && w.opts.follow {
+			if resolved.IsDir() && w.isActive(resolved) {
+				w.prog.warnf("not following %s: symlink cycle back to %s", path, e.target)
+			} else {
+				e.info = resolved
 			}
-			entry.hash = h
-		} else {
-			fmt.Fprintf(os.Stderr, "\r  Scanning %s: %d files...", label, count)
 		}
-		entries = append(entries, entry)
 
-		return nil
-	})
+		isDir := e.info.IsDir()
+		if w.ig.isExcluded(childRel, rawRel, isDir) {
+			continue
+		}
+		e.linkID = hardLinkID(e.info)
 
-	if err != nil {
-		return nil, err
+		w.entries = append(w.entries, e)
+		w.paths = append(w.paths, path)
+		w.prog.update(w.label, fmt.Sprintf("%d files", len(w.entries)))
+
+		if isDir {
+			w.active = append(w.active, e.info)
+			w.walkDir(path, rawRel)
+			w.active = w.active[:len(w.active)-1]
+		}
 	}
+}
 
-	if count > 0 {
-		fmt.Fprintf(os.Stderr, "\r  Scanning %s: %d files... done.                \n", label, count)
+func (w *treeWalker) isActive(dir os.FileInfo) bool {
+	for _, a := range w.active {
+		if os.SameFile(a, dir) {
+			return true
+		}
 	}
+	return false
+}
 
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].relPath < entries[j].relPath
-	})
+type hashResult struct {
+	index int
+	hash  string
+	err   error
+}
 
-	return entries, nil
+func hashJobs(opts options) int {
+	if opts.jobs > 0 {
+		return opts.jobs
+	}
+	return runtime.NumCPU()
+}
+
+// hashEntries reads each hard-linked inode only once.
+func hashEntries(entries []fileEntry, paths []string, label string, opts options, prog *progress) {
+	var pending []int
+	linked := make(map[string]int)
+	aliases := make(map[int]int)
+	for i := range entries {
+		if !entries[i].info.Mode().IsRegular() {
+			continue
+		}
+		if id := entries[i].linkID; id != "" {
+			if first, ok := linked[id]; ok {
+				aliases[i] = first
+				continue
+			}
+			linked[id] = i
+		}
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	defer func() {
+		for i, first := range aliases {
+			entries[i].hash = entries[first].hash
+		}
+	}()
+
+	// hashSlots is shared across trees so --jobs is a global limit.
+	slots := opts.hashSlots
+	if slots == nil {
+		slots = make(chan struct{}, hashJobs(opts))
+	}
+	jobs := make(chan int)
+	results := make(chan hashResult)
+	var wg sync.WaitGroup
+	for w := 0; w < hashJobs(opts); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				slots <- struct{}{}
+				h, err := hashWithCache(paths[i], entries[i].info, opts.hashCache)
+				<-slots
+				results <- hashResult{index: i, hash: h, err: err}
+			}
+		}()
+	}
+	go func() {
+		for _, i := range pending {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	done := 0
+	for r := range results {
+		done++
+		if r.err != nil {
+			prog.warnf("cannot hash %s: %v", entries[r.index].relPath, r.err)
+		}
+		entries[r.index].hash = r.hash
+		prog.update(label, fmt.Sprintf("hashing %d/%d files", done, len(pending)))
+	}
 }
 
 func hashFile(path string) (string, error) {
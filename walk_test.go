@@ -1,9 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHashFile_Success(t *testing.T) {
@@ -56,3 +60,195 @@ func TestHashFile_NotFound(t *testing.T) {
 		t.Error("hashFile on nonexistent file should return error")
 	}
 }
+
+func TestHashEntries_MatchesSequential(t *testing.T) {
+	dir := t.TempDir()
+	var entries []fileEntry
+	var paths []string
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("f%02d.txt", i))
+		if err := os.WriteFile(name, []byte(fmt.Sprintf("content %d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, fileEntry{relPath: filepath.Base(name), info: info})
+		paths = append(paths, name)
+	}
+	entries = append(entries, fileEntry{relPath: "sub", info: fakeInfo{name: "sub", dir: true}})
+	paths = append(paths, filepath.Join(dir, "sub"))
+
+	hashEntries(entries, paths, "A", options{jobs: 4}, newProgress(true, "A"))
+
+	for i, e := range entries[:50] {
+		want, err := hashFile(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.hash != want {
+			t.Errorf("%s: hash = %q, want %q", e.relPath, e.hash, want)
+		}
+	}
+	if entries[50].hash != "" {
+		t.Errorf("directory entry was hashed: %q", entries[50].hash)
+	}
+}
+
+func TestWalkTrees_Concurrent(t *testing.T) {
+	rootA := t.TempDir()
+	rootB := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(rootA, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(rootB, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ig := newIgnorer(nil, rootA, filterRules{})
+	lists, err := walkTrees([]string{rootA, rootB}, []string{"A", "B"}, ig, options{quiet: true, useHashes: true})
+	if err != nil {
+		t.Fatalf("walkTrees returned error: %v", err)
+	}
+	if len(lists[0]) != 2 || len(lists[1]) != 1 {
+		t.Fatalf("walkTrees returned %d and %d entries, want 2 and 1", len(lists[0]), len(lists[1]))
+	}
+	if lists[0][0].relPath != "a.txt" || lists[0][1].relPath != "b.txt" {
+		t.Errorf("A entries out of order: %q, %q", lists[0][0].relPath, lists[0][1].relPath)
+	}
+	if lists[1][0].hash == "" {
+		t.Error("B entry was not hashed")
+	}
+}
+
+func TestWalkTrees_LazyIgnoreRules(t *testing.T) {
+	isolateGitConfig(t)
+	rootA, rootB := t.TempDir(), t.TempDir()
+	for _, root := range []string{rootA, rootB} {
+		writeTestTree(t, root, map[string]string{
+			".gitignore":      "build/\n",
+			"src/.gitignore":  "*.tmp\n",
+			"src/main.go":     "package main",
+			"src/scratch.tmp": "x",
+			// A rule inside the excluded directory must never be read.
+			"build/.gitignore":  "!*\n",
+			"build/out/app.bin": "x",
+		})
+	}
+
+	ig := newIgnorer(nil, rootA, filterRules{})
+	lists, err := walkTrees([]string{rootA, rootB}, []string{"A", "B"}, ig, options{quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, list := range lists {
+		var paths []string
+		for _, e := range list {
+			paths = append(paths, e.relPath)
+		}
+		want := []string{".gitignore", "src", filepath.Join("src", ".gitignore"), filepath.Join("src", "main.go")}
+		if strings.Join(paths, " ") != strings.Join(want, " ") {
+			t.Errorf("walk %d = %v, want %v", i, paths, want)
+		}
+	}
+
+	var loaded []string
+	for dir := range ig.dirs {
+		loaded = append(loaded, dir)
+	}
+	sort.Strings(loaded)
+	if want := []string{".", "src"}; strings.Join(loaded, " ") != strings.Join(want, " ") {
+		t.Errorf("loaded rules for %v, want %v", loaded, want)
+	}
+}
+
+func TestWalkTree_Symlinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "conf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "conf", "app.yaml"), []byte("x: 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"current": "conf",
+		"broken":  "missing.txt",
+		"conf/up": "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(follow bool) map[string]fileEntry {
+		t.Helper()
+		entries, err := walkTree(root, newIgnorer(nil, root, filterRules{}), "A", options{follow: follow}, newProgress(true, "A"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]fileEntry)
+		for _, e := range entries {
+			m[e.relPath] = e
+		}
+		return m
+	}
+
+	plain := walk(false)
+	if e := plain["current"]; e.target != "conf" || e.info.Mode()&os.ModeSymlink == 0 || e.dangling {
+		t.Errorf("current = %+v, want an unfollowed link to conf", e)
+	}
+	if e := plain["broken"]; !e.dangling || e.target != "missing.txt" {
+		t.Errorf("broken = %+v, want a dangling link to missing.txt", e)
+	}
+	if _, ok := plain[filepath.Join("current", "app.yaml")]; ok {
+		t.Error("walk without --follow-symlinks descended into a linked directory")
+	}
+
+	followed := walk(true)
+	if e := followed["current"]; !e.info.IsDir() || e.target != "conf" {
+		t.Errorf("current = %+v, want the followed directory", e)
+	}
+	if _, ok := followed[filepath.Join("current", "app.yaml")]; !ok {
+		t.Error("walk with --follow-symlinks did not descend into a linked directory")
+	}
+	if e := followed[filepath.Join("conf", "up")]; e.info == nil || e.info.IsDir() {
+		t.Errorf("conf/up = %+v, want the cyclic link left unfollowed", e)
+	}
+	if !followed["broken"].dangling {
+		t.Error("broken is not dangling with --follow-symlinks")
+	}
+}
+
+func TestHashEntries_SharesHashSlots(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "f.txt")
+	writeTestFile(t, path, "data")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []fileEntry{{relPath: "f.txt", info: info}}
+
+	// Another tree's walk holds the only slot, so hashing must wait for it.
+	opts := options{jobs: 4, hashSlots: make(chan struct{}, 1)}
+	opts.hashSlots <- struct{}{}
+	done := make(chan struct{})
+	go func() {
+		hashEntries(entries, []string{path}, "A", opts, newProgress(true, "A"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("hashEntries ran without a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-opts.hashSlots
+	<-done
+	if entries[0].hash == "" {
+		t.Error("entry was not hashed once the slot was free")
+	}
+}